@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+)
+
+// blockRef points to a block of a file. The zero blockRef is a hole: a block that was never
+// written, has no tapestry object and reads as zero bytes, so sparse files only store the
+// blocks that hold data.
+type blockRef struct {
+	GUID  string
+	Sum   uint32 // crc32c of the bytes stored in tapestry
+	Codec string // name of the codec the block was stored with, empty if stored as is
+	Seal  bool   // the block was encrypted with the data key of the file after encoding
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func checksum(data []byte) uint32 {
+	return crc32.Checksum(data, castagnoli)
+}
+
+func (ref blockRef) isHole() bool {
+	return ref.GUID == ""
+}
+
+// intact reports whether `data` is an undamaged copy of the block
+func (ref blockRef) intact(data []byte) bool {
+	return checksum(data) == ref.Sum && verifyContent(ref.GUID, data)
+}
+
+// get returns the value of `key` from the first replica whose value passes `intact`. Each
+// replica that serves a damaged value lets us ask one more node, and once an intact value
+// is found it is stored again through the nodes that served damaged ones, which replaces
+// their copies. Damaged values without an intact one are reported as a *CorruptError.
+func (c *PuddleStoreClient) get(key string, intact func([]byte) bool) ([]byte, error) {
+	c.nodesMutex.Lock()
+	defer c.nodesMutex.Unlock()
+	if len(c.nodes) == 0 {
+		return nil, fmt.Errorf("get: %w", ErrNoReplicas)
+	}
+	var damaged []int
+	for i := 0; i < len(c.nodes) && i < c.config.NumReplicas+len(damaged); i++ {
+		idx := c.idx
+		c.idx = (c.idx + 1) % len(c.nodes)
+		value, err := c.nodes[idx].Get(key)
+		if err != nil {
+			continue
+		}
+		if !intact(value) {
+			damaged = append(damaged, idx)
+			continue
+		}
+		for _, idx := range damaged {
+			// the repair is best effort, the next read tries again
+			c.nodes[idx].Store(key, value)
+		}
+		return value, nil
+	}
+	if len(damaged) > 0 {
+		return nil, &CorruptError{GUID: key}
+	}
+	return nil, fmt.Errorf("get: key %s not found: %w", key, ErrNoReplicas)
+}
+
+// getBlock returns the stored bytes of the block `ref`, verified against its checksum
+func (c *PuddleStoreClient) getBlock(ctx context.Context, ref blockRef) ([]byte, error) {
+	var value []byte
+	err := withContext(ctx, func() (err error) {
+		value, err = c.get(ref.GUID, ref.intact)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,29 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// casPrefix starts the GUIDs of content addressed blocks. Random GUIDs are uuids, so the
+// two kinds of keys never collide and a reader can tell which ones to verify.
+const casPrefix = "sha256-"
+
+// contentKey returns the content addressed GUID of `block`
+func contentKey(block []byte) string {
+	sum := sha256.Sum256(block)
+	return casPrefix + hex.EncodeToString(sum[:])
+}
+
+// verifyContent reports whether `block` may be the content of the block `guid`. Only
+// content addressed blocks can be verified, all others pass.
+func verifyContent(guid string, block []byte) bool {
+	if !strings.HasPrefix(guid, casPrefix) {
+		return true
+	}
+	sum := sha256.Sum256(block)
+	want, err := hex.DecodeString(guid[len(casPrefix):])
+	return err == nil && bytes.Equal(sum[:], want)
+}
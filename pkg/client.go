@@ -1,6 +1,36 @@
 package pkg
 
-// Client is a puddlestore client interface that will communicate with puddlestore nodes
+import (
+	"context"
+	"io/fs"
+)
+
+// OpenOptions controls how `OpenWith` opens a file
+type OpenOptions struct {
+	// Create creates the file if it does not exist
+	Create bool
+	// Write opens the file for writing and flushes the inode on Close()
+	Write bool
+	// CreateParents creates every missing ancestor directory when Create is set
+	CreateParents bool
+	// NonBlocking fails with ErrLocked instead of waiting when another client holds a
+	// conflicting lock on the file, or on a parent directory the open has to lock
+	NonBlocking bool
+	// Snapshot opens the file read-only inside the snapshot of that name, in which case
+	// the path is relative to the directory the snapshot was taken of
+	Snapshot string
+	// Version opens the given previous version of a live file read-only, see `ListVersions`
+	Version int
+	// Erasure overrides Config.Erasure for a file created by this open. Existing files keep
+	// the code they were created with.
+	Erasure *ErasureCode
+}
+
+// Client is a puddlestore client interface that will communicate with puddlestore nodes.
+// Every operation is checked against the owner, group and mode bits of the inodes it
+// touches, on behalf of the client's Identity. Failed operations on paths return a
+// *fs.PathError, whose error can be matched against ErrNotExist, ErrExist and the other
+// ErrXxx values with errors.Is.
 type Client interface {
 	// `Open` opens a file and returns a file descriptor. If the `create` is true and the
 	// file does not exist, create the file. If `create` is false and the file does not exist,
@@ -11,6 +41,13 @@ type Client interface {
 	// multi-operation transactions.
 	Open(path string, create, write bool) (int, error)
 
+	// `OpenWith` is `Open` with the behaviour described by `opts`.
+	OpenWith(path string, opts OpenOptions) (int, error)
+
+	// `OpenFile` opens a file like `OpenWith` and wraps the file descriptor in a FileHandle
+	// with its own cursor, which implements the standard io interfaces.
+	OpenFile(path string, opts OpenOptions) (*FileHandle, error)
+
 	// `Close` closes the file and flushes its contents to the distributed filesystem.
 	// The updated closed file should be able to be opened again after successfully closing it.
 	// We only flush changes to the file on close to ensure copy-on-write atomicity of operations.
@@ -26,20 +63,155 @@ type Client interface {
 	// `Write` writes `data` starting at `offset` on an opened file. Writing beyond the
 	// file boundary automatically fills the file with zero bytes. Returns err if fd is not opened.
 	// If the file was opened with write = true flag, `Write` should return an error.
+	// Returns ErrFileTooLarge only if the write would end past the largest uint64 offset,
+	// whatever the block size.
 	Write(fd int, offset uint64, data []byte) error
 
+	// `Ftruncate` changes the size of an opened file to `size`. Shrinking drops the data past
+	// `size`, growing fills the file with zero bytes. Like `Write`, the change is only
+	// flushed on Close(). Returns err if fd is not opened for writing. Any uint64 size is
+	// valid, whatever the block size.
+	Ftruncate(fd int, size uint64) error
+
+	// `PunchHole` deallocates `length` bytes of an opened file starting at `offset`. The
+	// range reads as zero bytes afterwards, and blocks it covers entirely are no longer
+	// stored. The size of the file does not change. Like `Write`, the change is only
+	// flushed on Close(). Returns err if fd is not opened for writing.
+	PunchHole(fd int, offset, length uint64) error
+
+	// `Truncate` changes the size of the file at `path` to `size` and commits the change.
+	// Returns err if not exists or if `path` is a directory. Any uint64 size is valid,
+	// whatever the block size.
+	Truncate(path string, size uint64) error
+
 	// `Mkdir` creates directory at the specified path.
 	// Returns error if any parent directory does not exist (non-recursive).
 	Mkdir(path string) error
 
+	// `MkdirAll` creates directory at the specified path along with any missing parents.
+	// Returns nil if the directory already exists, and err if any ancestor is a file.
+	MkdirAll(path string) error
+
 	// `Remove` removes a directory or file. Returns err if not exists.
 	Remove(path string) error
 
 	// `List` lists file & directory names (not full names) under `path`. Returns err if not exists.
 	List(path string) ([]string, error)
 
+	// `Stat` returns the metadata of the file or directory at `path`. Returns err if not exists.
+	Stat(path string) (FileInfo, error)
+
+	// `Chmod` sets the permission bits of `path` to `mode`. Only the owner may change them.
+	Chmod(path string, mode fs.FileMode) error
+
+	// `Chown` sets the owner and group of `path`. Only the superuser may give a file away;
+	// the owner may change its group to one of the groups it belongs to.
+	Chown(path string, uid, gid uint32) error
+
+	// `SetXattr` sets the extended attribute `name` of `path` to `value`, replacing any
+	// previous value. The names and values of all attributes of one inode may not exceed
+	// MaxXattrSize bytes, or it fails with fs.ErrInvalid. Requires write permission on `path`.
+	SetXattr(path, name string, value []byte) error
+
+	// `GetXattr` returns the value of the extended attribute `name` of `path`. Returns err
+	// if the attribute is not set. Requires read permission on `path`.
+	GetXattr(path, name string) ([]byte, error)
+
+	// `ListXattr` returns the sorted names of all extended attributes of `path`. Requires
+	// read permission on `path`.
+	ListXattr(path string) ([]string, error)
+
+	// `RemoveXattr` removes the extended attribute `name` of `path`. Returns err if the
+	// attribute is not set. Requires write permission on `path`.
+	RemoveXattr(path, name string) error
+
+	// `Link` creates `path` as another name of the file at `existing`. Both names share one
+	// inode, and its data lives until the last name is removed. Returns err if `existing` does
+	// not exist or is a directory, or if `path` already exists.
+	Link(existing, path string) error
+
+	// `Lstat` is like `Stat`, but if `path` is a symbolic link it describes the link itself.
+	Lstat(path string) (FileInfo, error)
+
+	// `Symlink` creates a symbolic link at `link` that points to `target`. The target does not
+	// need to exist. Relative targets are resolved against the directory containing the link.
+	// Open, List, Mkdir and Stat follow links; Remove, Rename and Lstat act on the link itself.
+	Symlink(target, link string) error
+
+	// `Readlink` returns the target of the symbolic link at `path`. Returns err if `path` is
+	// not a symbolic link.
+	Readlink(path string) (string, error)
+
+	// `Clone` creates the file `dst` with the content of the file `src` without copying any
+	// data. Blocks are never modified in place, so both files can share them, and writing to
+	// either file only replaces the blocks of that file. Returns err if `src` is not a
+	// regular file or if `dst` already exists.
+	Clone(src, dst string) error
+
+	// `Rename` atomically moves the file or directory at `src` to `dst`, including the whole
+	// subtree of a directory. Returns err if `src` does not exist, `dst` already exists, the
+	// parent of `dst` is missing, or `dst` lies inside `src`.
+	Rename(src, dst string) error
+
+	// `Snapshot` captures the tree under the directory `dir` as the read-only snapshot
+	// `name`. The snapshot shares all blocks with the live files, so it only costs zookeeper
+	// space. Files inside it are opened with the Snapshot option of `OpenWith`.
+	Snapshot(dir, name string) error
+
+	// `ListSnapshots` describes all snapshots, sorted by name.
+	ListSnapshots() ([]SnapshotInfo, error)
+
+	// `DeleteSnapshot` deletes the snapshot `name`. Only its creator and the superuser may
+	// delete it.
+	DeleteSnapshot(name string) error
+
+	// `ListVersions` describes the previous versions of the file at `path` that are still
+	// kept, oldest first. Each Close that changed the file adds the content it replaced.
+	ListVersions(path string) ([]VersionInfo, error)
+
+	// `Restore` makes the content of the previous version `version` of the file at `path`
+	// current again. The content it replaces becomes a version itself.
+	Restore(path string, version int) error
+
+	// The `...Context` variants behave like the methods above, but give up with ctx.Err()
+	// once `ctx` is cancelled or its deadline passes, whether they are waiting for a lock,
+	// zookeeper or tapestry. An abandoned lock wait leaves no trace in the lock queue.
+	OpenContext(ctx context.Context, path string, create, write bool) (int, error)
+	OpenWithContext(ctx context.Context, path string, opts OpenOptions) (int, error)
+	OpenFileContext(ctx context.Context, path string, opts OpenOptions) (*FileHandle, error)
+	CloseContext(ctx context.Context, fd int) error
+	ReadContext(ctx context.Context, fd int, offset, size uint64) ([]byte, error)
+	WriteContext(ctx context.Context, fd int, offset uint64, data []byte) error
+	FtruncateContext(ctx context.Context, fd int, size uint64) error
+	TruncateContext(ctx context.Context, path string, size uint64) error
+	PunchHoleContext(ctx context.Context, fd int, offset, length uint64) error
+	MkdirContext(ctx context.Context, path string) error
+	MkdirAllContext(ctx context.Context, path string) error
+	RemoveContext(ctx context.Context, path string) error
+	ListContext(ctx context.Context, path string) ([]string, error)
+	StatContext(ctx context.Context, path string) (FileInfo, error)
+	LstatContext(ctx context.Context, path string) (FileInfo, error)
+	ChmodContext(ctx context.Context, path string, mode fs.FileMode) error
+	ChownContext(ctx context.Context, path string, uid, gid uint32) error
+	SetXattrContext(ctx context.Context, path, name string, value []byte) error
+	GetXattrContext(ctx context.Context, path, name string) ([]byte, error)
+	ListXattrContext(ctx context.Context, path string) ([]string, error)
+	RemoveXattrContext(ctx context.Context, path, name string) error
+	LinkContext(ctx context.Context, existing, path string) error
+	SymlinkContext(ctx context.Context, target, link string) error
+	ReadlinkContext(ctx context.Context, path string) (string, error)
+	RenameContext(ctx context.Context, src, dst string) error
+	CloneContext(ctx context.Context, src, dst string) error
+	SnapshotContext(ctx context.Context, dir, name string) error
+	ListSnapshotsContext(ctx context.Context) ([]SnapshotInfo, error)
+	DeleteSnapshotContext(ctx context.Context, name string) error
+	ListVersionsContext(ctx context.Context, path string) ([]VersionInfo, error)
+	RestoreContext(ctx context.Context, path string, version int) error
+
 	// Release zk connection. Subsequent calls on Exit()-ed clients should return error.
 	Exit()
 }
 
+var _ Client = (*PuddleStoreClient)(nil)
+
 // TODO: implement the Client interface
@@ -1,10 +1,15 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	tapestry "tapestry/pkg"
+	"time"
 
 	"github.com/go-zookeeper/zk"
 )
@@ -23,6 +28,9 @@ type PuddleStoreClient struct {
 	config    Config
 	blockRead uint64
 	readCnt   uint64
+
+	ident     Identity
+	masterKey []byte
 }
 
 func (c *PuddleStoreClient) WatchTap() {
@@ -65,24 +73,19 @@ func (c *PuddleStoreClient) WatchTap() {
 }
 
 func (c *PuddleStoreClient) Get(key string) ([]byte, error) {
-	c.nodesMutex.Lock()
-	defer c.nodesMutex.Unlock()
-	for i := 0; i < c.config.NumReplicas; i++ {
-		node := c.nodes[c.idx]
-		c.idx = (c.idx + 1) % len(c.nodes)
-		value, err := node.Get(key)
-		if err == nil {
-			return value, nil
-		}
-	}
-	return nil, fmt.Errorf("get: key %s not found", key)
+	return c.get(key, func(value []byte) bool { return verifyContent(key, value) })
 }
 
 func (c *PuddleStoreClient) Store(key string, value []byte) error {
+	return c.store(key, value, c.config.NumReplicas)
+}
+
+// store stores `value` under `key` on up to `copies` nodes, and succeeds if any took it
+func (c *PuddleStoreClient) store(key string, value []byte, copies int) error {
 	c.nodesMutex.Lock()
 	defer c.nodesMutex.Unlock()
 	cnt := 0
-	for i := 0; i < len(c.nodes) && cnt < c.config.NumReplicas; i++ {
+	for i := 0; i < len(c.nodes) && cnt < copies; i++ {
 		node := c.nodes[c.idx]
 		c.idx = (c.idx + 1) % len(c.nodes)
 		err := node.Store(key, value)
@@ -91,11 +94,91 @@ func (c *PuddleStoreClient) Store(key string, value []byte) error {
 		}
 	}
 	if cnt == 0 {
-		return fmt.Errorf("no node is available")
+		return fmt.Errorf("store: %w", ErrNoReplicas)
 	}
 	return nil
 }
 
+// storeAt stores `value` under `key` once, on the node of `slot` modulo the number of
+// nodes, or on the next node that takes it
+func (c *PuddleStoreClient) storeAt(key string, value []byte, slot uint64) error {
+	c.nodesMutex.Lock()
+	defer c.nodesMutex.Unlock()
+	for i := 0; i < len(c.nodes); i++ {
+		if c.nodes[(slot+uint64(i))%uint64(len(c.nodes))].Store(key, value) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("store: %w", ErrNoReplicas)
+}
+
+// storeBlocks journals and stores `blocks`, which maps keys to the bytes to store, `copies`
+// times each, or once in each of their slots if `slots` has any for them. The blocks are journaled
+// before they are stored, so the garbage collector finds them even if we fail before the
+// commit.
+func (c *PuddleStoreClient) storeBlocks(ctx context.Context, blocks map[string][]byte, copies int, slots map[string][]uint64) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	if c.config.ContentAddressed {
+		// a content key may name a block the collector is about to delete as garbage, so
+		// storing it again must not overlap with a collection
+		dlock := CreateDistLock(JOURNAL, c.zkConn)
+		if err := dlock.ReadLockContext(ctx); err != nil {
+			return err
+		}
+		defer dlock.Release()
+	}
+	guids := make([]string, 0, len(blocks))
+	for guid := range blocks {
+		guids = append(guids, guid)
+	}
+	err := journalBlocks(guids, false, c.zkConn)
+	if err != nil {
+		return err
+	}
+	for _, guid := range guids {
+		value := blocks[guid]
+		err = withContext(ctx, func() error {
+			if len(slots[guid]) == 0 {
+				return c.store(guid, value, copies)
+			}
+			for _, slot := range slots[guid] {
+				if err := c.storeAt(guid, value, slot); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetContext is Get, but gives up once ctx is done. The Tapestry request itself cannot be
+// cancelled, so it finishes in the background and its result is dropped.
+func (c *PuddleStoreClient) GetContext(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := withContext(ctx, func() (err error) {
+		value, err = c.Get(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// StoreContext is Store, but gives up once ctx is done. Like GetContext, the abandoned
+// request still finishes in the background.
+func (c *PuddleStoreClient) StoreContext(ctx context.Context, key string, value []byte) error {
+	return withContext(ctx, func() error {
+		return c.Store(key, value)
+	})
+}
+
 // `Open` opens a file and returns a file descriptor. If the `create` is true and the
 // file does not exist, create the file. If `create` is false and the file does not exist,
 // return an error. If `write` is true, then flush the resulting inode on Close(). If `write`
@@ -104,13 +187,13 @@ func (c *PuddleStoreClient) Store(key string, value []byte) error {
 // track of local file descriptors. Using `Open` allows for file-locking and
 // multi-operation transactions.
 func checkPath(path string) error {
-	if path[len(path)-1] == '/' || path[0] != '/' {
-		return fmt.Errorf("file name %s contains invalid character", path)
+	if len(path) == 0 || path[len(path)-1] == '/' || path[0] != '/' {
+		return fs.ErrInvalid
 	}
 	return nil
 }
 
-func (c *PuddleStoreClient) checkParent(path string) error {
+func (c *PuddleStoreClient) checkParent(ctx context.Context, path string) error {
 	parent := filepath.Dir(path)
 	exist, _, err := c.zkConn.Exists(parent)
 	if err != nil {
@@ -118,19 +201,86 @@ func (c *PuddleStoreClient) checkParent(path string) error {
 	}
 	if !exist {
 		// No parent path
-		return fmt.Errorf("the target file has no parent path")
+		return ErrNotExist
 	}
 
-	parentInode, err := c.getInode(parent)
+	parentInode, err := c.getInode(ctx, parent)
 	if err != nil {
 		return err
 	}
 	if !parentInode.IsDir {
-		return fmt.Errorf("open: the parent is not a directory")
+		return ErrNotDir
 	}
 	return nil
 }
 
+// resolve translates the user path `path` into the zookeeper path of the entry it names,
+// following symbolic links in every component except the last, which is only followed
+// when `followLast` is set. A missing last component is not an error so that callers
+// can go on and create it. Every directory walked through needs execute permission.
+func (c *PuddleStoreClient) resolve(ctx context.Context, path string, followLast bool) (string, error) {
+	links := 0
+	cur := ROOT
+	dir, err := c.getInode(ctx, ROOT)
+	if err != nil {
+		return "", err
+	}
+	rest := strings.Split(filepath.Clean(path), "/")
+	for len(rest) > 0 {
+		name := rest[0]
+		rest = rest[1:]
+		if name == "" || name == "." {
+			continue
+		}
+		if name == ".." {
+			if cur != ROOT {
+				cur = filepath.Dir(cur)
+				if dir, err = c.getInode(ctx, cur); err != nil {
+					return "", err
+				}
+			}
+			continue
+		}
+		if !dir.permits(c.ident, permExec) {
+			return "", errPermission("lookup", userPath(cur))
+		}
+
+		next := filepath.Join(cur, name)
+		last := len(rest) == 0
+		in, err := c.getInode(ctx, next)
+		if err == zk.ErrNoNode {
+			if last {
+				return next, nil
+			}
+			return "", &fs.PathError{Op: "lookup", Path: userPath(next), Err: ErrNotExist}
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if in.IsSymlink && (!last || followLast) {
+			links++
+			if links > maxSymlinks {
+				return "", ErrLoop
+			}
+			if strings.HasPrefix(in.Target, "/") {
+				cur = ROOT
+				if dir, err = c.getInode(ctx, ROOT); err != nil {
+					return "", err
+				}
+			}
+			rest = append(strings.Split(in.Target, "/"), rest...)
+			continue
+		}
+		if !last && !in.IsDir {
+			return "", &fs.PathError{Op: "lookup", Path: userPath(next), Err: ErrNotDir}
+		}
+		cur = next
+		dir = in
+	}
+	return cur, nil
+}
+
 func (c *PuddleStoreClient) generateNewFd() int {
 	if len(c.fdRecycle) > 0 {
 		fd := c.fdRecycle[len(c.fdRecycle)-1]
@@ -142,53 +292,129 @@ func (c *PuddleStoreClient) generateNewFd() int {
 	return fd
 }
 
-func (c *PuddleStoreClient) getInode(path string) (*inode, error) {
-	data, _, err := c.zkConn.Get(path)
+// getInode returns the inode that the directory entry at `path` refers to
+func (c *PuddleStoreClient) getInode(ctx context.Context, path string) (*inode, error) {
+	ino, err := lookupIno(ctx, path, c.zkConn)
 	if err != nil {
 		return nil, err
 	}
-	return decodeInode(data)
+	in, _, err := readInode(ctx, ino, c.zkConn)
+	return in, err
 }
 
-func (c *PuddleStoreClient) createFile(path string, write, dir bool) (*inode, *DistLock, error) {
+func (c *PuddleStoreClient) createFile(ctx context.Context, path string, write, dir bool) (*inode, *DistLock, error) {
 	in := &inode{
 		Size:   0,
 		IsDir:  dir,
-		Blocks: make([]string, 0),
+		Blocks: make(blockMap),
 	}
-
-	inode, err := encodeInode(*in)
+	dlock, err := c.createInode(ctx, path, in, write)
 	if err != nil {
 		return nil, nil, err
 	}
+	return in, dlock, nil
+}
 
-	parentlock := CreateDistLock(filepath.Dir(path), c.zkConn)
-	parentlock.WriteLock()
-	dlock, err := createNode(path, inode, write, c.zkConn)
-	parentlock.Release()
+// createInode creates `in` and its entry at `path` under the write lock of the parent,
+// and returns the lock of the new inode held for reading or writing. The new inode is
+// owned by the client and inherits its group and mode from the parent.
+func (c *PuddleStoreClient) createInode(ctx context.Context, path string, in *inode, write bool) (*DistLock, error) {
+	parent := filepath.Dir(path)
+	parentlock, err := entryLock(ctx, parent, c.zkConn)
+	if err != nil {
+		return nil, err
+	}
+	if err := parentlock.WriteLockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer parentlock.Release()
 
+	parentInode, err := c.getInode(ctx, parent)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	return in, dlock, nil
+	if !parentInode.permits(c.ident, permWrite|permExec) {
+		return nil, errPermission("create", userPath(path))
+	}
+	in.inherit(c.ident, parentInode)
+	return createNode(ctx, path, in, write, c.zkConn)
+}
+
+// checkModify returns err unless the client may add or remove entries in the parent
+// directory of `path`
+func (c *PuddleStoreClient) checkModify(ctx context.Context, op, path string) error {
+	parentInode, err := c.getInode(ctx, filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	if !parentInode.permits(c.ident, permWrite|permExec) {
+		return errPermission(op, userPath(path))
+	}
+	return nil
 }
 
 func (c *PuddleStoreClient) Open(path string, create, write bool) (int, error) {
+	return c.OpenContext(context.Background(), path, create, write)
+}
+
+// `OpenContext` is `Open` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) OpenContext(ctx context.Context, path string, create, write bool) (int, error) {
+	return c.OpenWithContext(ctx, path, OpenOptions{Create: create, Write: write})
+}
+
+// `OpenWith` is `Open` with the behaviour described by `opts`.
+func (c *PuddleStoreClient) OpenWith(path string, opts OpenOptions) (int, error) {
+	return c.OpenWithContext(context.Background(), path, opts)
+}
+
+// `OpenWithContext` is `OpenWith` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) OpenWithContext(ctx context.Context, path string, opts OpenOptions) (fd int, err error) {
+	defer func(name string) { err = pathError("open", name, err) }(path)
 	if c.zkConn == nil {
-		return -1, fmt.Errorf("Client has already been exited")
+		return -1, ErrClientClosed
 	}
 	if err := checkPath(path); err != nil {
 		return -1, err
 	}
-	path = filepath.Join(ROOT, path)
+	if opts.Erasure != nil {
+		if err := opts.Erasure.validate(c.config.NumTapestry); err != nil {
+			return -1, err
+		}
+	}
+	if opts.NonBlocking {
+		ctx = nonBlocking(ctx)
+	}
+	if opts.Snapshot != "" {
+		return c.openSnapshot(ctx, opts.Snapshot, path, opts)
+	}
+	if opts.Version != 0 {
+		return c.openVersion(ctx, path, opts)
+	}
+	create, write := opts.Create, opts.Write
+
+	if create && opts.CreateParents {
+		if err := c.mkdirAll(ctx, filepath.Dir(path)); err != nil {
+			return -1, err
+		}
+	}
+
+	path, err = c.resolve(ctx, path, true)
+	if err != nil {
+		return -1, err
+	}
 
-	err := c.checkParent(path)
+	err = c.checkParent(ctx, path)
 	if err != nil {
 		return -1, err
 	}
 
-	parentlock := CreateDistLock(filepath.Dir(path), c.zkConn)
-	parentlock.ReadLock()
+	parentlock, err := entryLock(ctx, filepath.Dir(path), c.zkConn)
+	if err != nil {
+		return -1, err
+	}
+	if err := parentlock.ReadLockContext(ctx); err != nil {
+		return -1, err
+	}
 	exist, _, err := c.zkConn.Exists(path)
 	parentlock.Release()
 	if err != nil {
@@ -196,7 +422,7 @@ func (c *PuddleStoreClient) Open(path string, create, write bool) (int, error) {
 	}
 
 	if !exist && !create {
-		return -1, fmt.Errorf("open: the target file does not exist")
+		return -1, ErrNotExist
 	}
 
 	flags := O_READ
@@ -205,39 +431,82 @@ func (c *PuddleStoreClient) Open(path string, create, write bool) (int, error) {
 	}
 	var in *inode
 	var dlock *DistLock
+	var version int32
 
 	if !exist && create {
 		// fmt.Println("create file", path)
-		in, dlock, err = c.createFile(path, write, false)
+		in = &inode{
+			Blocks:  make(blockMap),
+			Erasure: c.config.Erasure,
+		}
+		if opts.Erasure != nil {
+			in.Erasure = *opts.Erasure
+		}
+		dlock, err = c.createInode(ctx, path, in, write)
 		if err != nil {
 			return -1, err
 		}
 	} else {
-		dlock = CreateDistLock(path, c.zkConn)
+		ino, err := lookupIno(ctx, path, c.zkConn)
+		if err != nil {
+			return -1, err
+		}
+		dlock = CreateDistLock(inodePath(ino), c.zkConn)
 		if write {
-			dlock.WriteLock()
+			err = dlock.WriteLockContext(ctx)
 		} else {
-			dlock.ReadLock()
+			err = dlock.ReadLockContext(ctx)
+		}
+		if err != nil {
+			return -1, err
 		}
 
-		in, err = c.getInode(path)
+		// the entry may have been unlinked while we were waiting for the lock
+		var stat *zk.Stat
+		in, stat, err = readInode(ctx, ino, c.zkConn)
 		if err != nil {
 			dlock.Release()
 			return -1, err
 		}
+		version = stat.Version
 		if in.IsDir {
 			dlock.Release()
-			return -1, fmt.Errorf("open: the target is a directory")
+			return -1, ErrIsDir
+		}
+		want := uint32(permRead)
+		if write {
+			want |= permWrite
 		}
+		if !in.permits(c.ident, want) {
+			dlock.Release()
+			return -1, errPermission("open", userPath(path))
+		}
+	}
+
+	aead, err := c.fileKey(in)
+	if err != nil {
+		dlock.Release()
+		return -1, err
+	}
+	tree, err := c.loadTree(ctx, in)
+	if err != nil {
+		dlock.Release()
+		return -1, err
 	}
 
-	fd := c.generateNewFd()
+	fd = c.generateNewFd()
 	c.files[fd] = &File{
-		path:  path,
-		flags: int32(flags),
-		dlock: dlock,
-		in:    in,
-		cache: make(map[string][]byte),
+		// the file is committed to its inode, whose path is also the root of its lock
+		path:    dlock.root,
+		flags:   int32(flags),
+		dlock:   dlock,
+		in:      in,
+		version: version,
+		cache:   make(map[string][]byte),
+		created: !exist,
+		aead:    aead,
+		base:    in.Blocks.clone(),
+		tree:    tree,
 	}
 	// fmt.Println("Open:", path, create, write, "fd:", fd)
 	return fd, nil
@@ -248,41 +517,108 @@ func (c *PuddleStoreClient) Open(path string, create, write bool) (int, error) {
 // We only flush changes to the file on close to ensure copy-on-write atomicity of operations.
 // Refer to the handout for more information on why this is necessary.
 func (c *PuddleStoreClient) Close(fd int) error {
+	return c.CloseContext(context.Background(), fd)
+}
+
+// `CloseContext` is `Close` with a context that bounds lock waits and remote calls. The
+// file descriptor and its lock are released even if ctx is done before the commit, in
+// which case nothing is committed.
+func (c *PuddleStoreClient) CloseContext(ctx context.Context, fd int) error {
 	// fmt.Println("Close:", fd)
 	if c.zkConn == nil {
-		return fmt.Errorf("Client has already been exited")
+		return ErrClientClosed
 	}
 	if file, ok := c.files[fd]; ok {
 		defer func() {
-			file.dlock.Release()
+			if file.dlock != nil {
+				file.dlock.Release()
+			}
 			delete(c.files, fd)
 			c.fdRecycle = append(c.fdRecycle, fd)
 		}()
+		if file.frozen {
+			return nil
+		}
 
+		now := time.Now()
 		if file.flags&O_WRITE != 0 {
-			data, err := encodeInode(*file.in)
+			if file.dirty {
+				file.in.Mtime = now.UnixNano()
+			}
+			// blocks that were only read are stored already, and holes are never stored
+			stored, err := file.dirtyBlocks(c)
 			if err != nil {
 				return err
 			}
-
-			for _, guid := range file.in.Blocks {
-				if block, ok := file.cache[guid]; ok {
-					err = c.Store(guid, block)
-					if err != nil {
-						return err
-					}
+			copies := c.config.NumReplicas
+			var slots map[string][]uint64
+			if file.in.Erasure.enabled() {
+				// every fragment is stored once, the parity makes up for lost ones
+				var fragments map[string][]byte
+				fragments, slots, err = file.stripeBlocks(ctx, c, stored)
+				if err != nil {
+					return err
+				}
+				for key, shard := range fragments {
+					stored[key] = shard
 				}
+				copies = 1
+			}
+			pointers, err := packBlocks(file.in, c.config.ContentAddressed, file.tree)
+			if err != nil {
+				return err
+			}
+			data, err := encodeInode(*file.in)
+			if err != nil {
+				return err
+			}
+			err = c.storeBlocks(ctx, stored, copies, slots)
+			if err != nil {
+				return err
+			}
+			err = c.storeBlocks(ctx, pointers, c.config.NumReplicas, nil)
+			if err != nil {
+				return err
 			}
 
-			_, err = c.zkConn.Set(file.path, data, -1)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// a file created by this open replaces nothing worth keeping
+			if file.dirty && !file.created {
+				err = c.commitVersioned(file.path, data)
+			} else {
+				_, err = c.zkConn.Set(file.path, data, -1)
+			}
 			if err != nil {
+				return translate(err)
+			}
+		} else if file.accessed && staleAtime(file.in, now) {
+			// other readers may be doing the same, losing that race is fine
+			file.in.Atime = now.UnixNano()
+			pointers, err := packBlocks(file.in, c.config.ContentAddressed, file.tree)
+			if err != nil || len(pointers) > 0 {
+				// the blocks are as loaded, so every pointer block is reused
 				return err
 			}
+			data, err := encodeInode(*file.in)
+			if err != nil {
+				return err
+			}
+			_, err = c.zkConn.Set(file.path, data, file.version)
+			if err != nil && err != zk.ErrBadVersion {
+				return translate(err)
+			}
 		}
 		return nil
 	}
 
-	return fmt.Errorf("close: file descriptor is not valid")
+	return fmt.Errorf("close: %w", ErrBadFd)
+}
+
+// staleAtime reports whether reading the file at `now` should update its access time
+func staleAtime(in *inode, now time.Time) bool {
+	return in.Atime <= in.Mtime || now.Sub(time.Unix(0, in.Atime)) > atimeInterval
 }
 
 // `Read` returns a `size` amount of bytes starting at `offset` in an opened file.
@@ -290,52 +626,143 @@ func (c *PuddleStoreClient) Close(fd int) error {
 // If offset+size exceeds file boundary, return as much as possible with no error.
 // Returns err if fd is not opened.
 func (c *PuddleStoreClient) Read(fd int, offset, size uint64) ([]byte, error) {
+	return c.ReadContext(context.Background(), fd, offset, size)
+}
+
+// `ReadContext` is `Read` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) ReadContext(ctx context.Context, fd int, offset, size uint64) ([]byte, error) {
 	// fmt.Println("Read:", fd, offset, size)
 	if c.zkConn == nil {
-		return nil, fmt.Errorf("Client has already been exited")
+		return nil, ErrClientClosed
 	}
 	if file, ok := c.files[fd]; ok {
-		return file.read(c, offset, size)
+		return file.read(ctx, c, offset, size)
 	}
-	return nil, fmt.Errorf("read: file descriptor is not valid")
+	return nil, fmt.Errorf("read: %w", ErrBadFd)
 }
 
 // `Write` writes `data` starting at `offset` on an opened file. Writing beyond the
 // file boundary automatically fills the file with zero bytes. Returns err if fd is not opened.
 // If the file was opened with write = true flag, `Write` should return an error.
+// Returns ErrFileTooLarge only if the write would end past the largest uint64 offset,
+// whatever the block size.
 func (c *PuddleStoreClient) Write(fd int, offset uint64, data []byte) error {
+	return c.WriteContext(context.Background(), fd, offset, data)
+}
+
+// `WriteContext` is `Write` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) WriteContext(ctx context.Context, fd int, offset uint64, data []byte) error {
 	// fmt.Println("Write:", fd, offset, len(data))
 	if c.zkConn == nil {
-		return fmt.Errorf("Client has already been exited")
+		return ErrClientClosed
+	}
+	if file, ok := c.files[fd]; ok {
+		if file.flags&O_WRITE == 0 {
+			return fmt.Errorf("write: file is not opened for writing: %w", ErrBadFd)
+		}
+		return file.write(ctx, c, offset, data)
+	}
+	return fmt.Errorf("write: %w", ErrBadFd)
+}
+
+// `Ftruncate` changes the size of an opened file to `size`. Shrinking drops the data past
+// `size`, growing fills the file with zero bytes. Like `Write`, the change is only
+// flushed on Close(). Returns err if fd is not opened for writing. Any uint64 size is
+// valid, whatever the block size.
+func (c *PuddleStoreClient) Ftruncate(fd int, size uint64) error {
+	return c.FtruncateContext(context.Background(), fd, size)
+}
+
+// `FtruncateContext` is `Ftruncate` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) FtruncateContext(ctx context.Context, fd int, size uint64) error {
+	if c.zkConn == nil {
+		return ErrClientClosed
 	}
 	if file, ok := c.files[fd]; ok {
 		if file.flags&O_WRITE == 0 {
-			return fmt.Errorf("write: file is not opened for writing")
+			return fmt.Errorf("truncate: file is not opened for writing: %w", ErrBadFd)
 		}
-		return file.write(c, offset, data)
+		return file.truncate(ctx, c, size)
 	}
-	return fmt.Errorf("write: file descriptor is not valid")
+	return fmt.Errorf("truncate: %w", ErrBadFd)
+}
+
+// `PunchHole` deallocates `length` bytes of an opened file starting at `offset`. The range
+// reads as zero bytes afterwards, and blocks it covers entirely are no longer stored. The
+// size of the file does not change. Like `Write`, the change is only flushed on Close().
+// Returns err if fd is not opened for writing.
+func (c *PuddleStoreClient) PunchHole(fd int, offset, length uint64) error {
+	return c.PunchHoleContext(context.Background(), fd, offset, length)
+}
+
+// `PunchHoleContext` is `PunchHole` with a context that bounds remote calls.
+func (c *PuddleStoreClient) PunchHoleContext(ctx context.Context, fd int, offset, length uint64) error {
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	if file, ok := c.files[fd]; ok {
+		if file.flags&O_WRITE == 0 {
+			return fmt.Errorf("punchhole: file is not opened for writing: %w", ErrBadFd)
+		}
+		return file.punchHole(ctx, c, offset, length)
+	}
+	return fmt.Errorf("punchhole: %w", ErrBadFd)
+}
+
+// `Truncate` changes the size of the file at `path` to `size` and commits the change.
+// Returns err if not exists or if `path` is a directory. Any uint64 size is valid,
+// whatever the block size.
+func (c *PuddleStoreClient) Truncate(path string, size uint64) error {
+	return c.TruncateContext(context.Background(), path, size)
+}
+
+// `TruncateContext` is `Truncate` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) TruncateContext(ctx context.Context, path string, size uint64) (err error) {
+	defer func(name string) { err = pathError("truncate", name, err) }(path)
+	fd, err := c.OpenContext(ctx, path, false, true)
+	if err != nil {
+		return err
+	}
+	if err := c.FtruncateContext(ctx, fd, size); err != nil {
+		c.CloseContext(ctx, fd)
+		return err
+	}
+	return c.CloseContext(ctx, fd)
 }
 
 // `Mkdir` creates directory at the specified path.
 // Returns error if any parent directory does not exist (non-recursive).
 func (c *PuddleStoreClient) Mkdir(path string) error {
+	return c.MkdirContext(context.Background(), path)
+}
+
+// `MkdirContext` is `Mkdir` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) MkdirContext(ctx context.Context, path string) (err error) {
+	defer func(name string) { err = pathError("mkdir", name, err) }(path)
 	// fmt.Println("Mkdir:", path)
 	if c.zkConn == nil {
-		return fmt.Errorf("Client has already been exited")
+		return ErrClientClosed
 	}
-	if path[0] != '/' {
-		return fmt.Errorf("file name %s contains invalid character", path)
+	if len(path) == 0 || path[0] != '/' {
+		return fs.ErrInvalid
+	}
+	path, err = c.resolve(ctx, path, false)
+	if err != nil {
+		return err
 	}
-	path = filepath.Join(ROOT, path)
 
-	err := c.checkParent(path)
+	err = c.checkParent(ctx, path)
 	if err != nil {
 		// returns err if parent dir doesn't exist
 		return err
 	}
-	parentlock := CreateDistLock(filepath.Dir(path), c.zkConn)
-	parentlock.ReadLock()
+	parentlock, err := entryLock(ctx, filepath.Dir(path), c.zkConn)
+	if err != nil {
+		return err
+	}
+	if err := parentlock.ReadLockContext(ctx); err != nil {
+		return err
+	}
 	exist, _, err := c.zkConn.Exists(path)
 	parentlock.Release()
 
@@ -343,9 +770,9 @@ func (c *PuddleStoreClient) Mkdir(path string) error {
 		return err
 	}
 	if exist {
-		return fmt.Errorf("mkdir: the target directory already exists")
+		return ErrExist
 	}
-	_, dlock, err := c.createFile(path, false, true)
+	_, dlock, err := c.createFile(ctx, path, false, true)
 	if err != nil {
 		return err
 	}
@@ -354,48 +781,583 @@ func (c *PuddleStoreClient) Mkdir(path string) error {
 	return nil
 }
 
+// `MkdirAll` creates directory at the specified path along with any missing parents.
+// Returns nil if the directory already exists, and err if any ancestor is a file.
+func (c *PuddleStoreClient) MkdirAll(path string) error {
+	return c.MkdirAllContext(context.Background(), path)
+}
+
+// `MkdirAllContext` is `MkdirAll` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) MkdirAllContext(ctx context.Context, path string) (err error) {
+	defer func(name string) { err = pathError("mkdir", name, err) }(path)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	if len(path) == 0 || path[0] != '/' {
+		return fs.ErrInvalid
+	}
+	return c.mkdirAll(ctx, path)
+}
+
+// mkdirAll creates the directory at the user path `path` and its missing ancestors.
+// Other clients may race us on the same ancestors, so finding a directory that was
+// created in the meantime counts as success.
+func (c *PuddleStoreClient) mkdirAll(ctx context.Context, path string) error {
+	path = filepath.Clean(path)
+	if path == "/" {
+		return nil
+	}
+	if err := c.mkdirAll(ctx, filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	// the parent exists now, so this only fails on real errors
+	path, err := c.resolve(ctx, path, true)
+	if err != nil {
+		return err
+	}
+	in, err := c.getInode(ctx, path)
+	if err == nil {
+		if !in.IsDir {
+			return &fs.PathError{Op: "mkdir", Path: userPath(path), Err: ErrNotDir}
+		}
+		return nil
+	}
+	if err != zk.ErrNoNode {
+		return err
+	}
+
+	_, dlock, err := c.createFile(ctx, path, false, true)
+	if err == zk.ErrNodeExists {
+		in, err := c.getInode(ctx, path)
+		if err != nil {
+			return err
+		}
+		if !in.IsDir {
+			return &fs.PathError{Op: "mkdir", Path: userPath(path), Err: ErrNotDir}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dlock.Release()
+	return nil
+}
+
 // `Remove` removes a directory or file. Returns err if not exists.
 func (c *PuddleStoreClient) Remove(path string) error {
+	return c.RemoveContext(context.Background(), path)
+}
+
+// `RemoveContext` is `Remove` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) RemoveContext(ctx context.Context, path string) (err error) {
+	defer func(name string) { err = pathError("remove", name, err) }(path)
 	// fmt.Println("Remove:", path)
 	if c.zkConn == nil {
-		return fmt.Errorf("Client has already been exited")
+		return ErrClientClosed
+	}
+	path, err = c.resolve(ctx, path, false)
+	if err != nil {
+		return err
 	}
-	path = filepath.Join(ROOT, path)
 	exists, _, err := c.zkConn.Exists(path)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		return fmt.Errorf("remove: the target path does not exist")
+		return ErrNotExist
+	}
+	if err := c.checkModify(ctx, "remove", path); err != nil {
+		return err
+	}
+	in, err := c.getInode(ctx, path)
+	if err != nil {
+		return err
+	}
+	if in.IsDir && !in.permits(c.ident, permWrite|permExec) {
+		return errPermission("remove", userPath(path))
 	}
 
-	return removeNode(path, c.zkConn)
+	parentlock, err := entryLock(ctx, filepath.Dir(path), c.zkConn)
+	if err != nil {
+		return err
+	}
+	if err := parentlock.WriteLockContext(ctx); err != nil {
+		return err
+	}
+	defer parentlock.Release()
+	return removeNode(ctx, path, c.zkConn)
 }
 
 // `List` lists file & directory names (not full names) under `path`. Returns err if not exists.
 func (c *PuddleStoreClient) List(path string) ([]string, error) {
+	return c.ListContext(context.Background(), path)
+}
+
+// `ListContext` is `List` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) ListContext(ctx context.Context, path string) (names []string, err error) {
+	defer func(name string) { err = pathError("list", name, err) }(path)
 	// fmt.Println("List:", path)
 	if c.zkConn == nil {
-		return nil, fmt.Errorf("Client has already been exited")
+		return nil, ErrClientClosed
+	}
+	name := filepath.Base(path)
+	path, err = c.resolve(ctx, path, true)
+	if err != nil {
+		return nil, err
 	}
-	path = filepath.Join(ROOT, path)
 
-	dlock := CreateDistLock(path, c.zkConn)
-	dlock.ReadLock()
+	ino, err := lookupIno(ctx, path, c.zkConn)
+	if err != nil {
+		return nil, err
+	}
+	dlock := CreateDistLock(inodePath(ino), c.zkConn)
+	if err := dlock.ReadLockContext(ctx); err != nil {
+		return nil, err
+	}
 	defer dlock.Release()
 
-	ino, err := c.getInode(path)
+	in, _, err := readInode(ctx, ino, c.zkConn)
 	if err != nil {
 		return nil, err
 	}
-	if ino.IsDir {
+	if in.IsDir {
+		if !in.permits(c.ident, permRead) {
+			return nil, errPermission("list", userPath(path))
+		}
 		children, _, err := c.zkConn.Children(path)
 		if err != nil {
 			return nil, err
 		}
 		return children, nil
 	}
-	return []string{filepath.Base(path)}, nil
+	return []string{name}, nil
+}
+
+// `Stat` returns the metadata of the file or directory at `path`. Returns err if not exists.
+func (c *PuddleStoreClient) Stat(path string) (FileInfo, error) {
+	return c.StatContext(context.Background(), path)
+}
+
+// `StatContext` is `Stat` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) StatContext(ctx context.Context, path string) (FileInfo, error) {
+	return c.stat(ctx, path, true)
+}
+
+// `Lstat` is like `Stat`, but if `path` is a symbolic link it describes the link itself.
+func (c *PuddleStoreClient) Lstat(path string) (FileInfo, error) {
+	return c.LstatContext(context.Background(), path)
+}
+
+// `LstatContext` is `Lstat` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) LstatContext(ctx context.Context, path string) (FileInfo, error) {
+	return c.stat(ctx, path, false)
+}
+
+func (c *PuddleStoreClient) stat(ctx context.Context, path string, follow bool) (_ FileInfo, err error) {
+	op := "stat"
+	if !follow {
+		op = "lstat"
+	}
+	defer func(name string) { err = pathError(op, name, err) }(path)
+	if c.zkConn == nil {
+		return FileInfo{}, ErrClientClosed
+	}
+	if len(path) == 0 || path[0] != '/' {
+		return FileInfo{}, fs.ErrInvalid
+	}
+	in, stat, err := c.viewInode(ctx, path, follow)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return newFileInfo(path, in, stat), nil
+}
+
+// viewInode returns the inode that `path` names, read under the inode's read lock so it
+// is consistent with concurrent commits
+func (c *PuddleStoreClient) viewInode(ctx context.Context, path string, follow bool) (*inode, *zk.Stat, error) {
+	path, err := c.resolve(ctx, path, follow)
+	if err != nil {
+		return nil, nil, err
+	}
+	ino, err := lookupIno(ctx, path, c.zkConn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dlock := CreateDistLock(inodePath(ino), c.zkConn)
+	if err := dlock.ReadLockContext(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer dlock.Release()
+
+	return readInode(ctx, ino, c.zkConn)
+}
+
+// `Rename` atomically moves the file or directory at `src` to `dst`, including the whole
+// subtree of a directory. Returns err if `src` does not exist, `dst` already exists, the
+// parent of `dst` is missing, or `dst` lies inside `src`.
+func (c *PuddleStoreClient) Rename(src, dst string) error {
+	return c.RenameContext(context.Background(), src, dst)
+}
+
+// `RenameContext` is `Rename` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) RenameContext(ctx context.Context, src, dst string) (err error) {
+	defer func(name string) { err = pathError("rename", name, err) }(src)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	if err := checkPath(src); err != nil {
+		return err
+	}
+	if err := checkPath(dst); err != nil {
+		return err
+	}
+	src, err = c.resolve(ctx, src, false)
+	if err != nil {
+		return err
+	}
+	dst, err = c.resolve(ctx, dst, false)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(dst, src+"/") {
+		return fs.ErrInvalid
+	}
+
+	err = c.checkParent(ctx, dst)
+	if err != nil {
+		return err
+	}
+
+	// lock both parents in lexicographic order, which always places an ancestor before
+	// its descendants, so concurrent renames and creations cannot deadlock
+	parents := []string{filepath.Dir(src), filepath.Dir(dst)}
+	sort.Strings(parents)
+	if parents[0] == parents[1] {
+		parents = parents[:1]
+	}
+	for _, parent := range parents {
+		parentlock, err := entryLock(ctx, parent, c.zkConn)
+		if err != nil {
+			return err
+		}
+		if err := parentlock.WriteLockContext(ctx); err != nil {
+			return err
+		}
+		defer parentlock.Release()
+	}
+
+	exist, _, err := c.zkConn.Exists(src)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return ErrNotExist
+	}
+	if err := c.checkModify(ctx, "rename", src); err != nil {
+		return err
+	}
+	if err := c.checkModify(ctx, "rename", dst); err != nil {
+		return err
+	}
+	if src == dst {
+		return nil
+	}
+	exist, _, err = c.zkConn.Exists(dst)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return &fs.PathError{Op: "rename", Path: userPath(dst), Err: ErrExist}
+	}
+
+	return moveNode(ctx, src, dst, c.zkConn)
+}
+
+// updateInode applies `update` to the inode that `path` names, under the inode's write lock
+func (c *PuddleStoreClient) updateInode(ctx context.Context, path string, follow bool, update func(in *inode) error) error {
+	path, err := c.resolve(ctx, path, follow)
+	if err != nil {
+		return err
+	}
+	ino, err := lookupIno(ctx, path, c.zkConn)
+	if err != nil {
+		return err
+	}
+	dlock := CreateDistLock(inodePath(ino), c.zkConn)
+	if err := dlock.WriteLockContext(ctx); err != nil {
+		return err
+	}
+	defer dlock.Release()
+
+	in, stat, err := readInode(ctx, ino, c.zkConn)
+	if err != nil {
+		return err
+	}
+	if err := update(in); err != nil {
+		return err
+	}
+	data, err := encodeInode(*in)
+	if err != nil {
+		return err
+	}
+	_, err = c.zkConn.Set(inodePath(ino), data, stat.Version)
+	return err
+}
+
+// `Chmod` sets the permission bits of `path` to `mode`. Only the owner may change them.
+func (c *PuddleStoreClient) Chmod(path string, mode fs.FileMode) error {
+	return c.ChmodContext(context.Background(), path, mode)
+}
+
+// `ChmodContext` is `Chmod` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) ChmodContext(ctx context.Context, path string, mode fs.FileMode) (err error) {
+	defer func(name string) { err = pathError("chmod", name, err) }(path)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	return c.updateInode(ctx, path, true, func(in *inode) error {
+		if !c.ident.isRoot() && c.ident.Uid != in.Uid {
+			return errPermission("chmod", path)
+		}
+		in.Mode = uint32(mode.Perm())
+		return nil
+	})
+}
+
+// `Chown` sets the owner and group of `path`. Only the superuser may give a file away;
+// the owner may change its group to one of the groups it belongs to.
+func (c *PuddleStoreClient) Chown(path string, uid, gid uint32) error {
+	return c.ChownContext(context.Background(), path, uid, gid)
+}
+
+// `ChownContext` is `Chown` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) ChownContext(ctx context.Context, path string, uid, gid uint32) (err error) {
+	defer func(name string) { err = pathError("chown", name, err) }(path)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	return c.updateInode(ctx, path, true, func(in *inode) error {
+		if !c.ident.isRoot() && (c.ident.Uid != in.Uid || uid != in.Uid || !c.ident.inGroup(gid)) {
+			return errPermission("chown", path)
+		}
+		in.Uid = uid
+		in.Gid = gid
+		return nil
+	})
+}
+
+// `Link` creates `path` as another name of the file at `existing`. Both names share one
+// inode, and its data lives until the last name is removed. Returns err if `existing` does
+// not exist or is a directory, or if `path` already exists.
+func (c *PuddleStoreClient) Link(existing, path string) error {
+	return c.LinkContext(context.Background(), existing, path)
+}
+
+// `LinkContext` is `Link` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) LinkContext(ctx context.Context, existing, path string) (err error) {
+	defer func(name string) { err = pathError("link", name, err) }(path)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	if err := checkPath(existing); err != nil {
+		return err
+	}
+	if err := checkPath(path); err != nil {
+		return err
+	}
+	existing, err = c.resolve(ctx, existing, false)
+	if err != nil {
+		return err
+	}
+	path, err = c.resolve(ctx, path, false)
+	if err != nil {
+		return err
+	}
+
+	err = c.checkParent(ctx, path)
+	if err != nil {
+		return err
+	}
+	parentlock, err := entryLock(ctx, filepath.Dir(path), c.zkConn)
+	if err != nil {
+		return err
+	}
+	if err := parentlock.WriteLockContext(ctx); err != nil {
+		return err
+	}
+	defer parentlock.Release()
+
+	exist, _, err := c.zkConn.Exists(path)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return ErrExist
+	}
+	if err := c.checkModify(ctx, "link", path); err != nil {
+		return err
+	}
+	err = linkNode(ctx, existing, path, c.zkConn)
+	if err == zk.ErrNoNode {
+		return &fs.PathError{Op: "link", Path: userPath(existing), Err: ErrNotExist}
+	}
+	return err
+}
+
+// `Clone` creates the file `dst` with the content of the file `src` without copying any
+// data. Blocks are never modified in place, so both files can share them, and writing to
+// either file only replaces the blocks of that file. Returns err if `src` is not a
+// regular file or if `dst` already exists.
+func (c *PuddleStoreClient) Clone(src, dst string) error {
+	return c.CloneContext(context.Background(), src, dst)
+}
+
+// `CloneContext` is `Clone` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) CloneContext(ctx context.Context, src, dst string) (err error) {
+	defer func(name string) { err = pathError("clone", name, err) }(dst)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	if err := checkPath(src); err != nil {
+		return err
+	}
+	if err := checkPath(dst); err != nil {
+		return err
+	}
+
+	// the source is only locked while it is read and its blocks are journaled, so we never
+	// hold it together with the parent of `dst`. Once journaled, the blocks stay pending in
+	// the journal until the collector can see that the clone references them.
+	srcIn, err := c.cloneSource(ctx, src)
+	if err != nil {
+		return pathError("clone", src, err)
+	}
+
+	path, err := c.resolve(ctx, dst, false)
+	if err != nil {
+		return err
+	}
+	err = c.checkParent(ctx, path)
+	if err != nil {
+		return err
+	}
+	in := &inode{
+		Size:    srcIn.Size,
+		Blocks:  srcIn.Blocks,
+		Key:     srcIn.Key,
+		Erasure: srcIn.Erasure,
+		// the pointer blocks never change, so the clone shares them too
+		Indirect:  srcIn.Indirect,
+		Depth:     srcIn.Depth,
+		Allocated: srcIn.Allocated,
+	}
+	dlock, err := c.createInode(ctx, path, in, false)
+	if err != nil {
+		return err
+	}
+	return dlock.Release()
+}
+
+// cloneSource reads the inode of the regular file `src` under its read lock, and journals
+// its blocks before the lock is released
+func (c *PuddleStoreClient) cloneSource(ctx context.Context, src string) (*inode, error) {
+	path, err := c.resolve(ctx, src, true)
+	if err != nil {
+		return nil, err
+	}
+	ino, err := lookupIno(ctx, path, c.zkConn)
+	if err != nil {
+		return nil, err
+	}
+	dlock := CreateDistLock(inodePath(ino), c.zkConn)
+	if err := dlock.ReadLockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer dlock.Release()
+
+	in, _, err := readInode(ctx, ino, c.zkConn)
+	if err != nil {
+		return nil, err
+	}
+	if in.IsDir {
+		return nil, ErrIsDir
+	}
+	if !in.permits(c.ident, permRead) {
+		return nil, errPermission("clone", src)
+	}
+	if err := journalInodes([]*inode{in}, c.zkConn); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// `Symlink` creates a symbolic link at `link` that points to `target`. The target does not
+// need to exist. Relative targets are resolved against the directory containing the link.
+func (c *PuddleStoreClient) Symlink(target, link string) error {
+	return c.SymlinkContext(context.Background(), target, link)
+}
+
+// `SymlinkContext` is `Symlink` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) SymlinkContext(ctx context.Context, target, link string) (err error) {
+	defer func(name string) { err = pathError("symlink", name, err) }(link)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	if len(target) == 0 {
+		return fs.ErrInvalid
+	}
+	if err := checkPath(link); err != nil {
+		return err
+	}
+	path, err := c.resolve(ctx, link, false)
+	if err != nil {
+		return err
+	}
+
+	err = c.checkParent(ctx, path)
+	if err != nil {
+		return err
+	}
+	in := &inode{
+		Size:      uint64(len(target)),
+		IsSymlink: true,
+		Target:    target,
+		Blocks:    make(blockMap),
+	}
+	dlock, err := c.createInode(ctx, path, in, false)
+	if err != nil {
+		return err
+	}
+	return dlock.Release()
+}
+
+// `Readlink` returns the target of the symbolic link at `path`. Returns err if `path` is
+// not a symbolic link.
+func (c *PuddleStoreClient) Readlink(path string) (string, error) {
+	return c.ReadlinkContext(context.Background(), path)
+}
+
+// `ReadlinkContext` is `Readlink` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) ReadlinkContext(ctx context.Context, path string) (target string, err error) {
+	defer func(name string) { err = pathError("readlink", name, err) }(path)
+	if c.zkConn == nil {
+		return "", ErrClientClosed
+	}
+	path, err = c.resolve(ctx, path, false)
+	if err != nil {
+		return "", err
+	}
+	in, err := c.getInode(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if !in.IsSymlink {
+		return "", fs.ErrInvalid
+	}
+	return in.Target, nil
 }
 
 // Release zk connection. Subsequent calls on Exit()-ed clients should return error.
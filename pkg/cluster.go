@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	tapestry "tapestry/pkg"
@@ -12,6 +13,10 @@ import (
 const TAPESTRY_ROOT = "/tapestry"
 const ROOT = "/root"
 const LOCK = "/lock"
+const INODES = "/inode"
+const SNAPSHOTS = "/snapshot"
+const VERSIONS = "/version"
+const JOURNAL = "/journal"
 const SEED = 12345
 
 // Cluster is an interface for all nodes in a puddlestore cluster. One should be able to shutdown
@@ -39,8 +44,18 @@ func (c *Cluster) Shutdown() {
 	c.zkConn.Close()
 }
 
+// ClientOption configures a client created by NewClient
+type ClientOption func(*PuddleStoreClient)
+
+// WithIdentity makes the client act as `id` instead of the superuser
+func WithIdentity(id Identity) ClientOption {
+	return func(c *PuddleStoreClient) {
+		c.ident = id
+	}
+}
+
 // NewClient creates a new Puddlestore client
-func (c *Cluster) NewClient() (Client, error) {
+func (c *Cluster) NewClient(opts ...ClientOption) (Client, error) {
 	zkConn, err := ConnectZk(c.config.ZkAddr)
 	if err != nil {
 		return nil, err
@@ -69,6 +84,10 @@ func (c *Cluster) NewClient() (Client, error) {
 		config:    c.config,
 		blockRead: 0,
 		readCnt:   0,
+		ident:     Root,
+	}
+	for _, opt := range opts {
+		opt(client)
 	}
 	go client.WatchTap()
 	return client, nil
@@ -78,7 +97,7 @@ func CreateInitDir(path string, lockDir bool, zkConn *zk.Conn) error {
 	dir := inode{
 		Size:   0,
 		IsDir:  true,
-		Blocks: make([]string, 0),
+		Blocks: make(blockMap),
 	}
 	data, err := encodeInode(dir)
 	if err != nil {
@@ -96,11 +115,38 @@ func CreateInitDir(path string, lockDir bool, zkConn *zk.Conn) error {
 	return nil
 }
 
+// CreateRootDir creates the root directory entry and its inode in the inode table
+func CreateRootDir(zkConn *zk.Conn) error {
+	if exists, _, err := zkConn.Exists(ROOT); err != nil || exists {
+		return err
+	}
+	root := &inode{
+		Size:   0,
+		IsDir:  true,
+		Mode:   rootMode,
+		Blocks: make(blockMap),
+	}
+	dlock, err := createNode(context.Background(), ROOT, root, false, zkConn)
+	if err == zk.ErrNodeExists {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return dlock.Release()
+}
+
 // CreateCluster starts all nodes necessary for puddlestore
 func CreateCluster(config Config) (*Cluster, error) {
 	// Start your tapestry cluster with size config.NumTapestry. You should
 	// also use the zkAddr (zookeeper address) found in the config and pass it to
 	// your Tapestry constructor method
+	if _, err := lookupCodec(config.Codec); err != nil {
+		return nil, err
+	}
+	if err := config.Erasure.validate(config.NumTapestry); err != nil {
+		return nil, err
+	}
 
 	// start zookeeper connection
 	zkConn, err := ConnectZk(config.ZkAddr)
@@ -123,8 +169,32 @@ func CreateCluster(config Config) (*Cluster, error) {
 		return nil, err
 	}
 
+	// create inode table
+	err = CreateInitDir(INODES, false, zkConn)
+	if err != nil {
+		return nil, err
+	}
+
+	// create snapshot directory
+	err = CreateInitDir(SNAPSHOTS, false, zkConn)
+	if err != nil {
+		return nil, err
+	}
+
+	// create version history directory
+	err = CreateInitDir(VERSIONS, false, zkConn)
+	if err != nil {
+		return nil, err
+	}
+
+	// create block journal directory and its lock
+	err = CreateInitDir(JOURNAL, true, zkConn)
+	if err != nil {
+		return nil, err
+	}
+
 	// create file system root directory
-	err = CreateInitDir(ROOT, true, zkConn)
+	err = CreateRootDir(zkConn)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// Codec transforms blocks between their content and the bytes stored in tapestry. The
+// codec of each block is recorded by name in its block reference, so a codec has to be
+// registered with RegisterCodec in every client that reads blocks it encoded.
+type Codec interface {
+	// Name identifies the codec in block references. It must not be empty.
+	Name() string
+	Encode(block []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+var (
+	codecsMutex sync.RWMutex
+	codecs      = map[string]Codec{
+		"flate": flateCodec{},
+		"gzip":  gzipCodec{},
+	}
+)
+
+// RegisterCodec makes `codec` available under its name, replacing any codec of that name
+func RegisterCodec(codec Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// lookupCodec returns the codec called `name`, or nil for the empty name, which stores
+// blocks as they are
+func lookupCodec(name string) (Codec, error) {
+	if name == "" {
+		return nil, nil
+	}
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return codec, nil
+}
+
+// encodeBlock returns the bytes to store for `block` and the name of the codec that
+// produced them. Blocks the codec does not shrink are stored as they are.
+func encodeBlock(codec Codec, block []byte) ([]byte, string, error) {
+	if codec == nil {
+		return block, "", nil
+	}
+	data, err := codec.Encode(block)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) >= len(block) {
+		return block, "", nil
+	}
+	return data, codec.Name(), nil
+}
+
+// decodeBlock returns the content of the block `ref` from the bytes stored for it
+func decodeBlock(ref blockRef, data []byte) ([]byte, error) {
+	codec, err := lookupCodec(ref.Codec)
+	if err != nil || codec == nil {
+		return data, err
+	}
+	return codec.Decode(data)
+}
+
+// flateCodec compresses blocks with DEFLATE
+type flateCodec struct{}
+
+func (flateCodec) Name() string { return "flate" }
+
+func (flateCodec) Encode(block []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(block); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (flateCodec) Decode(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// gzipCodec compresses blocks with gzip, which adds a header and a checksum to DEFLATE
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) Encode(block []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(block); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -2,8 +2,8 @@ package pkg
 
 // Config for the puddlestore distributed file system
 type Config struct {
-	// BlockSize is size of a block in bytes. Direct and indirect blocks
-	// are the same size. inodes have no set size to make life easier
+	// BlockSize is size of a data block in bytes. Pointer blocks list up to 1024 block
+	// references whatever the block size, which keeps inodes at a constant size
 	BlockSize uint64
 
 	// NumReplicas is the amount of tapestry nodes to replicate each (VGUID, data) pair to
@@ -14,6 +14,24 @@ type Config struct {
 
 	// ZkAddr is the address of a zookeeper node
 	ZkAddr string
+
+	// MaxVersions is the number of previous versions of its content that each file keeps.
+	// Zero, the default, disables the version history.
+	MaxVersions int
+
+	// ContentAddressed names blocks by a hash of their content instead of a random GUID,
+	// so identical blocks are stored once and blocks read back are verified against their
+	// key. Files written in either mode stay readable in the other.
+	ContentAddressed bool
+
+	// Codec is the name of the codec that encodes blocks before they are stored, such as
+	// "flate" or "gzip", or a codec added with RegisterCodec. Blocks the codec does not
+	// shrink are stored as they are. Empty stores all blocks as they are.
+	Codec string
+
+	// Erasure is the erasure code of new files, which OpenOptions.Erasure overrides. The
+	// zero ErasureCode replicates their blocks NumReplicas times instead.
+	Erasure ErasureCode
 }
 
 // DefaultConfig is the default config for puddlestore. It is `lightweight` on purpose
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+)
+
+// dataKeySize is the size of the AES-256 key each encrypted file has for its blocks
+const dataKeySize = 32
+
+// WithMasterKey makes the client encrypt the blocks it writes with AES-GCM. Each file gets
+// a random data key, which is stored in its inode wrapped by `key`, so neither tapestry
+// nor zookeeper ever hold the content or the key in the clear. `key` must be 16, 24 or 32
+// bytes long, and every client reading the files needs the same key.
+func WithMasterKey(key []byte) ClientOption {
+	return func(c *PuddleStoreClient) {
+		c.masterKey = key
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// blockData returns the additional data a sealed block is authenticated with, so its
+// ciphertext only opens in its place: its block number, followed by its GUID unless
+// the GUID is a content key, which is only known after sealing and covers the
+// ciphertext anyway
+func blockData(i uint64, guid string, contentAddressed bool) []byte {
+	ad := make([]byte, 8, 8+len(guid))
+	binary.BigEndian.PutUint64(ad, i)
+	if !contentAddressed {
+		ad = append(ad, guid...)
+	}
+	return ad
+}
+
+// seal encrypts `plain` with a random nonce, which it prepends to the ciphertext. `ad`
+// is authenticated but not stored, and open needs the same.
+func seal(aead cipher.AEAD, plain, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, ad), nil
+}
+
+// open decrypts what seal returned, and fails if it was changed since or `ad` differs
+func open(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("message authentication failed")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], ad)
+}
+
+// fileKey returns the cipher of the data key of `in`, or nil if its blocks are stored in
+// the clear
+func (c *PuddleStoreClient) fileKey(in *inode) (cipher.AEAD, error) {
+	if in.Key == nil {
+		return nil, nil
+	}
+	if c.masterKey == nil {
+		return nil, ErrNoKey
+	}
+	master, err := newGCM(c.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := open(master, in.Key, nil)
+	if err != nil {
+		// the file was encrypted under another master key
+		return nil, ErrNoKey
+	}
+	return newGCM(key)
+}
+
+// newFileKey gives `in` a new wrapped data key and returns its cipher
+func (c *PuddleStoreClient) newFileKey(in *inode) (cipher.AEAD, error) {
+	master, err := newGCM(c.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(master, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	in.Key = wrapped
+	return newGCM(key)
+}
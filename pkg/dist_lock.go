@@ -1,9 +1,11 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"sort"
+	"time"
 
 	"github.com/go-zookeeper/zk"
 )
@@ -13,6 +15,16 @@ const writelockPrefix = "/w-"
 
 const initlock = "/initlock"
 
+// nonBlockingKey marks a context whose lock acquisitions should fail with ErrLocked
+// instead of waiting
+type nonBlockingKey struct{}
+
+// nonBlocking returns a copy of ctx under which ReadLockContext and WriteLockContext
+// behave like TryReadLock and TryWriteLock
+func nonBlocking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonBlockingKey{}, true)
+}
+
 // DistLock is a distributed lock that can be initialized with a root Zookeeper
 // path and a Zookeeper connection. It can write, via the Zookeeper connection,
 // to the root path.
@@ -69,6 +81,37 @@ func createLockNode(path string, zkConn *zk.Conn) error {
 // }
 
 func (d *DistLock) ReadLock() (err error) {
+	return d.ReadLockContext(context.Background())
+}
+
+// ReadLockContext is ReadLock, but gives up once ctx is done. An abandoned wait removes
+// its sequence node, so it never blocks the clients queued behind it.
+func (d *DistLock) ReadLockContext(ctx context.Context) (err error) {
+	return d.readLock(ctx, ctx.Value(nonBlockingKey{}) != nil)
+}
+
+// TryReadLock takes the read lock if that does not require waiting, and returns ErrLocked
+// otherwise
+func (d *DistLock) TryReadLock() error {
+	return d.readLock(context.Background(), true)
+}
+
+// ReadLockTimeout waits at most `timeout` for the read lock, and returns ErrLocked if it
+// was not obtained in time
+func (d *DistLock) ReadLockTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := d.ReadLockContext(ctx)
+	if err == context.DeadlineExceeded {
+		return ErrLocked
+	}
+	return err
+}
+
+func (d *DistLock) readLock(ctx context.Context, try bool) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	lockNode := filepath.Join(LOCK, Hash(d.root))
 	d.path, err = d.zkConn.Create(lockNode+readlockPrefix, []byte{}, zk.FlagEphemeral|zk.FlagSequence, zk.WorldACL(zk.PermAll))
 	if err != nil {
@@ -108,20 +151,44 @@ func (d *DistLock) ReadLock() (err error) {
 				break
 			}
 		}
-		exist, _, ch, err := d.zkConn.ExistsW(lockNode + "/" + watchFile)
-		if err != nil {
-			fmt.Println("ExistsW error:", err)
-			d.zkConn.Delete(d.path, -1)
+		if err := d.await(ctx, lockNode+"/"+watchFile, try); err != nil {
 			return err
 		}
-
-		if exist {
-			<-ch
-		}
 	}
 }
 
 func (d *DistLock) WriteLock() (err error) {
+	return d.WriteLockContext(context.Background())
+}
+
+// WriteLockContext is WriteLock, but gives up once ctx is done. An abandoned wait removes
+// its sequence node, so it never blocks the clients queued behind it.
+func (d *DistLock) WriteLockContext(ctx context.Context) (err error) {
+	return d.writeLock(ctx, ctx.Value(nonBlockingKey{}) != nil)
+}
+
+// TryWriteLock takes the write lock if that does not require waiting, and returns
+// ErrLocked otherwise
+func (d *DistLock) TryWriteLock() error {
+	return d.writeLock(context.Background(), true)
+}
+
+// WriteLockTimeout waits at most `timeout` for the write lock, and returns ErrLocked if it
+// was not obtained in time
+func (d *DistLock) WriteLockTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := d.WriteLockContext(ctx)
+	if err == context.DeadlineExceeded {
+		return ErrLocked
+	}
+	return err
+}
+
+func (d *DistLock) writeLock(ctx context.Context, try bool) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	lockNode := filepath.Join(LOCK, Hash(d.root))
 	d.path, err = d.zkConn.Create(lockNode+writelockPrefix, []byte{}, zk.FlagEphemeral|zk.FlagSequence, zk.WorldACL(zk.PermAll))
 	if err != nil {
@@ -155,21 +222,53 @@ func (d *DistLock) WriteLock() (err error) {
 		var prev string
 		for i, v := range list {
 			if lockNode+"/"+v == d.path {
-				prev = d.root + "/" + list[i-1]
+				prev = lockNode + "/" + list[i-1]
 				break
 			}
 		}
+		if err := d.await(ctx, prev, try); err != nil {
+			return err
+		}
+	}
+}
 
-		exist, _, ch, err := d.zkConn.ExistsW(prev)
+// await blocks until the lock node `prev` is gone. A try does not wait, it fails with
+// ErrLocked if `prev` still exists. Whenever the lock is not obtained, our own sequence
+// node is removed and ctx.Err() or ErrLocked is returned.
+func (d *DistLock) await(ctx context.Context, prev string, try bool) error {
+	if try {
+		exist, _, err := d.zkConn.Exists(prev)
+		if err == nil && exist {
+			err = ErrLocked
+		}
 		if err != nil {
-			fmt.Println("ExistsW error:", err)
-			d.zkConn.Delete(d.path, -1)
+			d.abandon()
 			return err
 		}
-		if exist {
-			<-ch
-		}
+		return nil
 	}
+
+	exist, _, ch, err := d.zkConn.ExistsW(prev)
+	if err != nil {
+		d.abandon()
+		return err
+	}
+	if !exist {
+		return nil
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		d.abandon()
+		return ctx.Err()
+	}
+}
+
+// abandon removes our sequence node from the lock queue
+func (d *DistLock) abandon() {
+	d.zkConn.Delete(d.path, -1)
+	d.path = ""
 }
 
 // The unlock protocol is very simple: clients wishing to release a lock simply delete the node they created in step 1.
@@ -0,0 +1,419 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+)
+
+// ErasureCode splits the blocks of a file into stripes of Data blocks and protects each
+// stripe with Parity Reed-Solomon fragments instead of replicating every block. Each data
+// and parity fragment is stored once, so a stripe costs (Data+Parity)/Data times its size
+// and survives the loss of any Parity of its fragments. The zero ErasureCode replicates
+// blocks Config.NumReplicas times.
+type ErasureCode struct {
+	Data   int
+	Parity int
+}
+
+func (e ErasureCode) enabled() bool {
+	return e.Parity > 0
+}
+
+// validate checks the code against a cluster of `nodes` tapestry nodes. Every fragment of
+// a stripe needs a node of its own, or losing one node could lose more than Parity of them.
+func (e ErasureCode) validate(nodes int) error {
+	if e.Data < 0 || e.Parity < 0 || (e.Parity > 0 && e.Data < 1) || e.Data+e.Parity > 256 {
+		return fmt.Errorf("erasure code %d+%d: %w", e.Data, e.Parity, fs.ErrInvalid)
+	}
+	if e.enabled() && e.Data+e.Parity > nodes {
+		return fmt.Errorf("erasure code %d+%d needs %d tapestry nodes, the cluster has %d: %w",
+			e.Data, e.Parity, e.Data+e.Parity, nodes, fs.ErrInvalid)
+	}
+	return nil
+}
+
+// slot returns the placement slot of fragment `j` of the stripe starting at block
+// `start`. The Data+Parity fragments of a stripe take consecutive slots, so they are
+// stored on distinct nodes, and consecutive stripes start on different nodes.
+func (e ErasureCode) slot(start uint64, j int) uint64 {
+	return start/uint64(e.Data)*uint64(e.Data+e.Parity) + uint64(j)
+}
+
+// parityPrefix starts the keys of parity fragments. A parity key is derived from the GUIDs
+// of the data blocks of its stripe, so changing any block of a stripe gives it new parity
+// fragments, and the garbage collector can find the live ones from the inodes.
+const parityPrefix = "parity-"
+
+func parityKey(stripe []blockRef, j int) string {
+	hasher := sha256.New()
+	for _, ref := range stripe {
+		hasher.Write([]byte(ref.GUID + "\n"))
+	}
+	hasher.Write([]byte(strconv.Itoa(j)))
+	return parityPrefix + hex.EncodeToString(hasher.Sum(nil))
+}
+
+// stripeOf returns the Data blocks of the stripe that block `i` belongs to, holes
+// included, and the number of its first block
+func stripeOf(blocks blockMap, code ErasureCode, i uint64) ([]blockRef, uint64) {
+	start := i - i%uint64(code.Data)
+	stripe := make([]blockRef, code.Data)
+	for j := range stripe {
+		stripe[j] = blocks[start+uint64(j)]
+	}
+	return stripe, start
+}
+
+// stripes returns the first blocks of the stripes of `blocks` that hold data, in order
+func stripes(blocks blockMap, code ErasureCode) []uint64 {
+	seen := make(map[uint64]bool)
+	starts := make([]uint64, 0)
+	for i := range blocks {
+		start := i - i%uint64(code.Data)
+		if !seen[start] {
+			seen[start] = true
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts
+}
+
+// parityKeys returns the keys of the parity fragments of all stripes of `in` that hold data
+func parityKeys(in *inode) []string {
+	keys := make([]string, 0)
+	if !in.Erasure.enabled() {
+		return keys
+	}
+	for _, start := range stripes(in.Blocks, in.Erasure) {
+		stripe, _ := stripeOf(in.Blocks, in.Erasure, start)
+		for j := 0; j < in.Erasure.Parity; j++ {
+			keys = append(keys, parityKey(stripe, j))
+		}
+	}
+	return keys
+}
+
+// Fragments of a stripe are coded at the same length. The data fragments are the stored
+// bytes of the blocks, which differ in length once they are compressed or encrypted, so
+// each is framed with its length and padded to the longest one. Holes are empty.
+func frame(data []byte, size int) []byte {
+	shard := make([]byte, size)
+	binary.BigEndian.PutUint32(shard, uint32(len(data)))
+	copy(shard[4:], data)
+	return shard
+}
+
+func unframe(shard []byte) ([]byte, error) {
+	if len(shard) < 4 {
+		return nil, errors.New("short fragment")
+	}
+	n := binary.BigEndian.Uint32(shard)
+	if uint64(n) > uint64(len(shard)-4) {
+		return nil, errors.New("short fragment")
+	}
+	return shard[4 : 4+n], nil
+}
+
+// Parity fragments have no block reference to hold their checksum, so each is stored
+// behind the crc32c of the rest of it
+func sealParity(shard []byte) []byte {
+	sealed := make([]byte, 4+len(shard))
+	binary.BigEndian.PutUint32(sealed, checksum(shard))
+	copy(sealed[4:], shard)
+	return sealed
+}
+
+func parityIntact(sealed []byte) bool {
+	return len(sealed) >= 4 && binary.BigEndian.Uint32(sealed) == checksum(sealed[4:])
+}
+
+// GF(2^8) arithmetic with the polynomial x^8+x^4+x^3+x^2+1
+var (
+	gfExp [510]byte
+	gfLog [256]int
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfExp[i+255] = byte(x)
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-gfLog[a]]
+}
+
+func gfPow(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]*n%255]
+}
+
+// invert returns the inverse of the square matrix `m` by Gauss-Jordan elimination
+func invert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	work := make([][]byte, n)
+	for i := range m {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], m[i])
+		work[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errors.New("singular matrix")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		inv := gfInv(work[col][col])
+		for j := range work[col] {
+			work[col][j] = gfMul(work[col][j], inv)
+		}
+		for i := 0; i < n; i++ {
+			if i == col || work[i][col] == 0 {
+				continue
+			}
+			f := work[i][col]
+			for j := range work[i] {
+				work[i][j] ^= gfMul(f, work[col][j])
+			}
+		}
+	}
+	for i := range work {
+		work[i] = work[i][n:]
+	}
+	return work, nil
+}
+
+// matrix returns the (Data+Parity) x Data coding matrix. It is a Vandermonde matrix turned
+// systematic, so the first Data rows are the identity and any Data rows are invertible.
+func (e ErasureCode) matrix() [][]byte {
+	n := e.Data + e.Parity
+	vand := make([][]byte, n)
+	for r := range vand {
+		vand[r] = make([]byte, e.Data)
+		for c := range vand[r] {
+			vand[r][c] = gfPow(byte(r), c)
+		}
+	}
+	// the top of a Vandermonde matrix with distinct rows is invertible
+	top, _ := invert(vand[:e.Data])
+	return mulMatrix(vand, top)
+}
+
+func mulMatrix(a, b [][]byte) [][]byte {
+	res := make([][]byte, len(a))
+	for i := range a {
+		res[i] = make([]byte, len(b[0]))
+		for j := range res[i] {
+			var v byte
+			for k := range b {
+				v ^= gfMul(a[i][k], b[k][j])
+			}
+			res[i][j] = v
+		}
+	}
+	return res
+}
+
+// combine returns the sum of `shards` weighted by `coeffs`
+func combine(coeffs []byte, shards [][]byte) []byte {
+	out := make([]byte, len(shards[0]))
+	for i, shard := range shards {
+		if coeffs[i] == 0 {
+			continue
+		}
+		for b := range out {
+			out[b] ^= gfMul(coeffs[i], shard[b])
+		}
+	}
+	return out
+}
+
+// encodeStripe returns the parity fragments of the stored bytes `data` of a stripe
+func encodeStripe(code ErasureCode, data [][]byte) [][]byte {
+	size := 4
+	for _, d := range data {
+		if len(d)+4 > size {
+			size = len(d) + 4
+		}
+	}
+	shards := make([][]byte, code.Data)
+	for i := range shards {
+		shards[i] = frame(data[i], size)
+	}
+	m := code.matrix()
+	parity := make([][]byte, code.Parity)
+	for j := range parity {
+		parity[j] = combine(m[code.Data+j], shards)
+	}
+	return parity
+}
+
+// decodeStripe returns the data fragment `want` from `shards`, which holds the Data data
+// fragments followed by the Parity parity fragments of a stripe, nil where unavailable
+func decodeStripe(code ErasureCode, shards [][]byte, want int) ([]byte, error) {
+	m := code.matrix()
+	rows := make([][]byte, 0, code.Data)
+	avail := make([][]byte, 0, code.Data)
+	for i, shard := range shards {
+		if shard != nil && len(avail) < code.Data {
+			rows = append(rows, m[i])
+			avail = append(avail, shard)
+		}
+	}
+	if len(avail) < code.Data {
+		return nil, ErrNoReplicas
+	}
+	inv, err := invert(rows)
+	if err != nil {
+		return nil, err
+	}
+	return unframe(combine(inv[want], avail))
+}
+
+// reconstruct rebuilds the stored bytes of block `i` of `blocks` from the other fragments
+// of its stripe, and stores them again for the next reader
+func (c *PuddleStoreClient) reconstruct(ctx context.Context, blocks blockMap, code ErasureCode, i uint64) ([]byte, error) {
+	stripe, start := stripeOf(blocks, code, i)
+	shards := make([][]byte, code.Data+code.Parity)
+	size := -1
+	for j := 0; j < code.Parity; j++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sealed, err := c.get(parityKey(stripe, j), parityIntact)
+		if err == nil && (size < 0 || len(sealed)-4 == size) {
+			shards[code.Data+j] = sealed[4:]
+			size = len(sealed) - 4
+		}
+	}
+	if size < 0 {
+		return nil, ErrNoReplicas
+	}
+	for j := 0; j < code.Data; j++ {
+		switch {
+		case start+uint64(j) == i:
+			continue
+		case stripe[j].isHole():
+			shards[j] = frame(nil, size)
+		default:
+			data, err := c.getBlock(ctx, stripe[j])
+			if err == nil && len(data)+4 <= size {
+				shards[j] = frame(data, size)
+			}
+		}
+	}
+
+	want := int(i - start)
+	data, err := decodeStripe(code, shards, want)
+	if err != nil {
+		return nil, err
+	}
+	if !stripe[want].intact(data) {
+		return nil, &CorruptError{GUID: stripe[want].GUID}
+	}
+	// put the rebuilt block back in its slot
+	c.storeAt(stripe[want].GUID, data, code.slot(start, want))
+	return data, nil
+}
+
+// stripeBlocks returns all data and parity fragments of the stripes that changed since the
+// file was opened, keyed by their GUIDs and parity keys, and the slots each is stored in.
+// Equal content addressed blocks share a GUID, so a block is stored once in the slot of
+// every position it takes, which keeps each fragment of a stripe on a node of its own.
+// `dirty` holds the stored bytes of the written blocks, the others are fetched. The
+// unchanged data fragments are stored again, since they may sit on the node a new
+// fragment of their stripe is placed on.
+func (file *File) stripeBlocks(ctx context.Context, c *PuddleStoreClient, dirty map[string][]byte) (map[string][]byte, map[string][]uint64, error) {
+	code := file.in.Erasure
+	blocks := make(map[string][]byte)
+	slots := make(map[string][]uint64)
+	for _, start := range stripes(file.in.Blocks, code) {
+		stripe, _ := stripeOf(file.in.Blocks, code, start)
+		if !file.stripeChanged(start) {
+			continue
+		}
+		data := make([][]byte, len(stripe))
+		for j, ref := range stripe {
+			if ref.isHole() {
+				continue
+			}
+			d, ok := dirty[ref.GUID]
+			if !ok {
+				var err error
+				d, err = file.storedBlock(ctx, c, start+uint64(j))
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			data[j] = d
+			blocks[ref.GUID] = d
+			slots[ref.GUID] = append(slots[ref.GUID], code.slot(start, j))
+		}
+		for j, shard := range encodeStripe(code, data) {
+			key := parityKey(stripe, j)
+			blocks[key] = sealParity(shard)
+			slots[key] = append(slots[key], code.slot(start, code.Data+j))
+		}
+	}
+	return blocks, slots, nil
+}
+
+// stripeChanged reports whether the stripe at `start` differs from the one the file was
+// opened with
+func (file *File) stripeChanged(start uint64) bool {
+	old, _ := stripeOf(file.base, file.in.Erasure, start)
+	for j, ref := range old {
+		if file.in.Blocks[start+uint64(j)].GUID != ref.GUID {
+			return true
+		}
+	}
+	return false
+}
+
+// storedBlock returns the stored bytes of block `i`, rebuilding them from the rest of its
+// stripe if no intact copy is available. Only blocks unchanged since the file was opened
+// have parity to be rebuilt from.
+func (file *File) storedBlock(ctx context.Context, c *PuddleStoreClient, i uint64) ([]byte, error) {
+	ref := file.in.Blocks[i]
+	data, err := c.getBlock(ctx, ref)
+	if err == nil || !file.in.Erasure.enabled() || file.base[i].GUID != ref.GUID {
+		return data, err
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	if rebuilt, rerr := c.reconstruct(ctx, file.base, file.in.Erasure, i); rerr == nil {
+		return rebuilt, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// Errors returned by the client. Operations on paths wrap them in a *fs.PathError, so
+// callers should test for them with errors.Is. Where io/fs has a matching error, the
+// error either is that error or wraps it, so errors.Is(err, fs.ErrNotExist) works too.
+var (
+	ErrNotExist     = fs.ErrNotExist
+	ErrExist        = fs.ErrExist
+	ErrPermission   = fs.ErrPermission
+	ErrIsDir        = &wrapError{"is a directory", fs.ErrInvalid}
+	ErrNotDir       = &wrapError{"not a directory", fs.ErrInvalid}
+	ErrBadFd        = &wrapError{"bad file descriptor", fs.ErrInvalid}
+	ErrClientClosed = &wrapError{"client has already been exited", fs.ErrClosed}
+	ErrLoop         = &wrapError{"too many levels of symbolic links", fs.ErrInvalid}
+	ErrLocked       = errors.New("file is locked")
+	ErrNoReplicas   = errors.New("no replica is available")
+	ErrCorrupt      = errors.New("block is corrupted")
+	ErrNoKey        = &wrapError{"file is encrypted with another master key", fs.ErrPermission}
+	ErrFileTooLarge = &wrapError{"file too large", fs.ErrInvalid}
+)
+
+// CorruptError reports a block that no replica holds an intact copy of. It matches
+// ErrCorrupt.
+type CorruptError struct {
+	GUID string
+}
+
+func (e *CorruptError) Error() string { return "block " + e.GUID + " is corrupted" }
+func (e *CorruptError) Unwrap() error { return ErrCorrupt }
+
+// wrapError is an error with its own message that still matches the io/fs error it wraps
+type wrapError struct {
+	msg string
+	err error
+}
+
+func (e *wrapError) Error() string { return e.msg }
+func (e *wrapError) Unwrap() error { return e.err }
+
+// translate replaces zookeeper errors that have a client level meaning by their ErrXxx
+// counterparts
+func translate(err error) error {
+	switch err {
+	case zk.ErrNoNode:
+		return ErrNotExist
+	case zk.ErrNodeExists:
+		return ErrExist
+	}
+	return err
+}
+
+// pathError reports that `op` on the user path `path` failed with `err`. Errors that
+// already name a path are kept as they are, so the innermost operation is reported.
+func pathError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &fs.PathError{Op: op, Path: path, Err: translate(err)}
+}
+
+// userPath returns the user visible path of the zookeeper entry at `path`
+func userPath(path string) string {
+	if path == ROOT {
+		return "/"
+	}
+	return strings.TrimPrefix(path, ROOT)
+}
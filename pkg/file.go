@@ -1,8 +1,13 @@
 package pkg
 
 import (
+	"context"
+	"crypto/cipher"
 	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-zookeeper/zk"
 	"github.com/google/uuid"
@@ -14,76 +19,421 @@ const (
 )
 
 type File struct {
-	flags int32
-	dlock *DistLock
-	cache map[string][]byte
-	path  string
-	in    *inode
+	flags    int32
+	dlock    *DistLock // nil for files opened in a snapshot
+	cache    map[string][]byte
+	path     string
+	in       *inode
+	version  int32                     // zookeeper version of the inode when it was opened
+	dirty    bool                      // the file content was changed
+	accessed bool                      // the file content was read
+	frozen   bool                      // opened in a snapshot or at a version, so it is never committed
+	created  bool                      // the file was created when it was opened
+	written  map[string]bool           // blocks created since the file was opened, which Close stores
+	aead     cipher.AEAD               // cipher of the data key, nil if the file is not encrypted
+	base     blockMap                  // blocks when the file was opened, whose stripes have parity
+	tree     map[string][]pointerEntry // entries of the pointer blocks loaded at open, by GUID
 }
 
+// atimeInterval is how stale the access time may get before a read updates it. Like
+// relatime, the access time is also updated when it is older than the modification time.
+const atimeInterval = 24 * time.Hour
+
+// maxSymlinks is the number of symbolic links a single path lookup may follow
+const maxSymlinks = 40
+
+// inode is stored in the inode table under INODES, keyed by its inode number. Entries
+// under ROOT only hold a dirent pointing into the table, so one inode may have several
+// names. Locks on files and directories are keyed by the inode path as well.
 type inode struct {
-	Size   uint64
-	IsDir  bool
-	Blocks []string
+	Size      uint64
+	IsDir     bool
+	IsSymlink bool
+	Target    string
+	Nlink     uint32
+	Uid       uint32
+	Gid       uint32
+	Mode      uint32
+	Xattrs    map[string][]byte
+	Ctime     int64    // creation time in unix nanoseconds
+	Mtime     int64    // last modification of the content, or of the entries of a directory
+	Atime     int64    // last access, updated lazily
+	Blocks    blockMap // the direct blocks in zookeeper, all blocks once loaded, see loadBlocks
+	Key       []byte   // data key of the blocks, wrapped by the master key; nil if not encrypted
+	Erasure   ErasureCode
+
+	Indirect  blockRef // root of the tree of pointer blocks listing the blocks after the direct ones
+	Depth     int      // number of levels of that tree
+	Allocated int      // number of blocks that are not holes
+}
+
+// dirent is the content of a directory entry znode under ROOT
+type dirent struct {
+	Ino uint64
+}
+
+const inodePrefix = "/i-"
+
+// inodePath returns the znode path of inode `ino` in the inode table
+func inodePath(ino uint64) string {
+	return fmt.Sprintf("%s%s%010d", INODES, inodePrefix, ino)
+}
+
+// inodeNumber returns the inode number of the inode table entry at `path`
+func inodeNumber(path string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(path, INODES+inodePrefix), 10, 64)
+}
+
+// lookupIno returns the inode number of the directory entry at `path`
+func lookupIno(ctx context.Context, path string, zkConn *zk.Conn) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	data, _, err := zkConn.Get(path)
+	if err != nil {
+		return 0, err
+	}
+	ent, err := decodeDirent(data)
+	if err != nil {
+		return 0, err
+	}
+	return ent.Ino, nil
+}
+
+// readInode returns inode `ino` together with the stat of its znode
+func readInode(ctx context.Context, ino uint64, zkConn *zk.Conn) (*inode, *zk.Stat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	data, stat, err := zkConn.Get(inodePath(ino))
+	if err != nil {
+		return nil, nil, err
+	}
+	in, err := decodeInode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return in, stat, nil
 }
 
-func createNode(path string, data []byte, write bool, zkConn *zk.Conn) (*DistLock, error) {
-	err := createLockNode(path, zkConn)
+// entryLock returns the lock of the inode that the directory entry at `path` refers to
+func entryLock(ctx context.Context, path string, zkConn *zk.Conn) (*DistLock, error) {
+	ino, err := lookupIno(ctx, path, zkConn)
 	if err != nil {
 		return nil, err
 	}
+	return CreateDistLock(inodePath(ino), zkConn), nil
+}
 
-	dlock := CreateDistLock(path, zkConn)
+// touchDir returns the transaction operation that sets the modification time of the
+// directory at `path` to `now`. The caller must hold the directory's write lock.
+func touchDir(ctx context.Context, path string, now int64, zkConn *zk.Conn) (*zk.SetDataRequest, error) {
+	ino, err := lookupIno(ctx, path, zkConn)
+	if err != nil {
+		return nil, err
+	}
+	in, stat, err := readInode(ctx, ino, zkConn)
+	if err != nil {
+		return nil, err
+	}
+	in.Mtime = now
+	data, err := encodeInode(*in)
+	if err != nil {
+		return nil, err
+	}
+	return &zk.SetDataRequest{Path: inodePath(ino), Data: data, Version: stat.Version}, nil
+}
+
+// createNode allocates a new inode holding `in` in the inode table and links it at `path`.
+// The inode lock is taken before the entry becomes visible and is returned to the caller.
+// The caller must hold the write lock of the parent directory.
+func createNode(ctx context.Context, path string, in *inode, write bool, zkConn *zk.Conn) (*DistLock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	in.Nlink = 1
+	in.Ctime, in.Mtime, in.Atime = now, now, now
+	data, err := encodeInode(*in)
+	if err != nil {
+		return nil, err
+	}
+	inoPath, err := zkConn.Create(INODES+inodePrefix, data, zk.FlagSequence, zk.WorldACL(zk.PermAll))
+	if err != nil {
+		return nil, err
+	}
+	ino, err := inodeNumber(inoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = createLockNode(inoPath, zkConn)
+	if err != nil {
+		zkConn.Delete(inoPath, -1)
+		return nil, err
+	}
+
+	// nobody else knows the inode yet, so this does not wait
+	dlock := CreateDistLock(inoPath, zkConn)
 	if write {
-		dlock.WriteLock()
+		err = dlock.WriteLockContext(ctx)
 	} else {
-		dlock.ReadLock()
+		err = dlock.ReadLockContext(ctx)
+	}
+	if err != nil {
+		zkConn.Delete(filepath.Join(LOCK, Hash(inoPath)), -1)
+		zkConn.Delete(inoPath, -1)
+		return nil, err
 	}
 
-	_, err = zkConn.Create(path, data, 0, zk.WorldACL(zk.PermAll))
+	err = func() error {
+		ent, err := encodeDirent(dirent{Ino: ino})
+		if err != nil {
+			return err
+		}
+		ops := []interface{}{&zk.CreateRequest{Path: path, Data: ent, Acl: zk.WorldACL(zk.PermAll)}}
+		if path != ROOT {
+			touch, err := touchDir(ctx, filepath.Dir(path), now, zkConn)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, touch)
+		}
+		_, err = zkConn.Multi(ops...)
+		return err
+	}()
 	if err != nil {
 		dlock.Release()
+		zkConn.Delete(filepath.Join(LOCK, Hash(inoPath)), -1)
+		zkConn.Delete(inoPath, -1)
 		return nil, err
 	}
 	return dlock, nil
 }
 
-func removeNode(path string, zkConn *zk.Conn) error {
-	dlock := CreateDistLock(path, zkConn)
-	dlock.WriteLock()
-	defer dlock.Release()
-
-	data, _, err := zkConn.Get(path)
+// removeNode unlinks the directory entry at `path`, recursively for directories. The
+// inode is dropped from the table together with its last name, which also drops the
+// last reference to its blocks. The caller must hold the write lock of the parent.
+func removeNode(ctx context.Context, path string, zkConn *zk.Conn) error {
+	ino, err := lookupIno(ctx, path, zkConn)
 	if err == zk.ErrNoNode {
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("remove: error when zookeeper is trying to find target, %v", err)
+		return err
 	}
 
-	in, err := decodeInode(data)
+	dlock := CreateDistLock(inodePath(ino), zkConn)
+	if err := dlock.WriteLockContext(ctx); err != nil {
+		return err
+	}
+
+	in, _, err := readInode(ctx, ino, zkConn)
 	if err != nil {
-		return fmt.Errorf("remove: error when decoding... %v", err)
+		dlock.Release()
+		return err
 	}
 	if in.IsDir {
 		children, _, err := zkConn.Children(path)
 		if err != nil {
+			dlock.Release()
 			return err
 		}
 		for _, child := range children {
-			err = removeNode(filepath.Join(path, child), zkConn)
+			err = removeNode(ctx, filepath.Join(path, child), zkConn)
 			if err != nil {
+				dlock.Release()
 				return err
 			}
 		}
 	}
-	return zkConn.Delete(path, -1)
+
+	// removing the children touched the inode, so read it again
+	in, stat, err := readInode(ctx, ino, zkConn)
+	if err != nil {
+		dlock.Release()
+		return err
+	}
+	touch, err := touchDir(ctx, filepath.Dir(path), time.Now().UnixNano(), zkConn)
+	if err != nil {
+		dlock.Release()
+		return err
+	}
+
+	ops := []interface{}{&zk.DeleteRequest{Path: path, Version: -1}, touch}
+	last := in.Nlink <= 1
+	if last {
+		ops = append(ops, &zk.DeleteRequest{Path: inodePath(ino), Version: stat.Version})
+	} else {
+		in.Nlink--
+		data, err := encodeInode(*in)
+		if err != nil {
+			dlock.Release()
+			return err
+		}
+		ops = append(ops, &zk.SetDataRequest{Path: inodePath(ino), Data: data, Version: stat.Version})
+	}
+	_, err = zkConn.Multi(ops...)
+	dlock.Release()
+	if err != nil {
+		return err
+	}
+	if last {
+		// fails with ErrNotEmpty if a waiter is still queued, which is harmless
+		zkConn.Delete(filepath.Join(LOCK, Hash(inodePath(ino))), -1)
+		dropVersions(ino, zkConn)
+	}
+	return nil
+}
+
+// linkNode adds `path` as another name of the inode behind the entry at `existing`. The
+// caller must hold the write lock of the new entry's parent.
+func linkNode(ctx context.Context, existing, path string, zkConn *zk.Conn) error {
+	ino, err := lookupIno(ctx, existing, zkConn)
+	if err != nil {
+		return err
+	}
+	dlock := CreateDistLock(inodePath(ino), zkConn)
+	if err := dlock.WriteLockContext(ctx); err != nil {
+		return err
+	}
+	defer dlock.Release()
+
+	in, stat, err := readInode(ctx, ino, zkConn)
+	if err != nil {
+		return err
+	}
+	if in.IsDir {
+		return ErrIsDir
+	}
+	in.Nlink++
+	data, err := encodeInode(*in)
+	if err != nil {
+		return err
+	}
+	ent, err := encodeDirent(dirent{Ino: ino})
+	if err != nil {
+		return err
+	}
+	touch, err := touchDir(ctx, filepath.Dir(path), time.Now().UnixNano(), zkConn)
+	if err != nil {
+		return err
+	}
+	_, err = zkConn.Multi(
+		&zk.CreateRequest{Path: path, Data: ent, Acl: zk.WorldACL(zk.PermAll)},
+		&zk.SetDataRequest{Path: inodePath(ino), Data: data, Version: stat.Version},
+		touch,
+	)
+	return err
+}
+
+type treeNode struct {
+	path string
+	data []byte
+}
+
+// lockTree locks the directory at `path` and all directories below it in pre-order, for
+// writing if `write` is set, and returns every entry of the subtree together with the
+// acquired locks. Each directory is locked before its children are listed, so no entry
+// can be added or removed behind our back. Files are not locked since their inodes do
+// not move.
+func lockTree(ctx context.Context, path string, write bool, zkConn *zk.Conn) ([]treeNode, []*DistLock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	data, _, err := zkConn.Get(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes := []treeNode{{path: path, data: data}}
+
+	ent, err := decodeDirent(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	in, _, err := readInode(ctx, ent.Ino, zkConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !in.IsDir {
+		return nodes, nil, nil
+	}
+
+	dlock := CreateDistLock(inodePath(ent.Ino), zkConn)
+	if write {
+		err = dlock.WriteLockContext(ctx)
+	} else {
+		err = dlock.ReadLockContext(ctx)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	locks := []*DistLock{dlock}
+
+	children, _, err := zkConn.Children(path)
+	if err != nil {
+		releaseLocks(locks)
+		return nil, nil, err
+	}
+	for _, child := range children {
+		subNodes, subLocks, err := lockTree(ctx, filepath.Join(path, child), write, zkConn)
+		if err != nil {
+			releaseLocks(locks)
+			return nil, nil, err
+		}
+		nodes = append(nodes, subNodes...)
+		locks = append(locks, subLocks...)
+	}
+	return nodes, locks, nil
+}
+
+// releaseLocks releases locks in the reverse order of acquisition
+func releaseLocks(locks []*DistLock) {
+	for i := len(locks) - 1; i >= 0; i-- {
+		locks[i].Release()
+	}
 }
 
-func (file *File) read(c *PuddleStoreClient, offset, size uint64) ([]byte, error) {
+// moveNode moves the directory entry at `src` together with its subtree to `dst` in a
+// single zookeeper transaction. The caller must hold write locks on the parents of both
+// paths. Inodes and their locks stay where they are, only the entries are moved.
+func moveNode(ctx context.Context, src, dst string, zkConn *zk.Conn) error {
+	tree, locks, err := lockTree(ctx, src, true, zkConn)
+	if err != nil {
+		return err
+	}
+	defer releaseLocks(locks)
+
+	ops := make([]interface{}, 0, 2*len(tree)+2)
+	for _, node := range tree {
+		newPath := dst + strings.TrimPrefix(node.path, src)
+		ops = append(ops, &zk.CreateRequest{Path: newPath, Data: node.data, Acl: zk.WorldACL(zk.PermAll)})
+	}
+	for i := len(tree) - 1; i >= 0; i-- {
+		ops = append(ops, &zk.DeleteRequest{Path: tree[i].path, Version: -1})
+	}
+
+	now := time.Now().UnixNano()
+	parents := []string{filepath.Dir(src)}
+	if filepath.Dir(dst) != filepath.Dir(src) {
+		parents = append(parents, filepath.Dir(dst))
+	}
+	for _, parent := range parents {
+		touch, err := touchDir(ctx, parent, now, zkConn)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, touch)
+	}
+
+	_, err = zkConn.Multi(ops...)
+	return err
+}
+
+func (file *File) read(ctx context.Context, c *PuddleStoreClient, offset, size uint64) ([]byte, error) {
 	var res []byte = make([]byte, 0)
 	pos := offset % c.config.BlockSize
-	blocknum := int(offset / c.config.BlockSize)
+	blocknum := offset / c.config.BlockSize
 	prefetchCnt := 0
 	var bytes uint64 = 0
 	c.readCnt++
@@ -91,17 +441,12 @@ func (file *File) read(c *PuddleStoreClient, offset, size uint64) ([]byte, error
 	avg := int(c.blockRead / c.readCnt)
 
 	for bytes < size && offset < file.in.Size {
+		file.accessed = true
 		length := min(size-bytes, c.config.BlockSize-pos)
 		length = min(length, file.in.Size-offset)
-		guid := file.in.Blocks[blocknum]
-		block, ok := file.cache[guid]
-		var err error
-		if !ok {
-			block, err = c.Get(guid)
-			if err != nil {
-				return nil, err
-			}
-			file.cache[guid] = block
+		block, err := file.fetchBlock(ctx, c, blocknum)
+		if err != nil {
+			return nil, err
 		}
 		res = append(res, block[pos:pos+length]...)
 		bytes += length
@@ -112,14 +457,12 @@ func (file *File) read(c *PuddleStoreClient, offset, size uint64) ([]byte, error
 	}
 
 	// prefetch
-	for prefetchCnt < avg && blocknum < len(file.in.Blocks) {
-		guid := file.in.Blocks[blocknum]
-		if _, ok := file.cache[guid]; !ok {
-			block, err := c.Get(guid)
-			if err != nil {
+	count := blockCount(file.in.Size, c.config.BlockSize)
+	for prefetchCnt < avg && blocknum < count {
+		if _, ok := file.in.Blocks[blocknum]; ok {
+			if _, err := file.fetchBlock(ctx, c, blocknum); err != nil {
 				return nil, err
 			}
-			file.cache[guid] = block
 		}
 		blocknum++
 		prefetchCnt++
@@ -131,40 +474,81 @@ func (file *File) createNewBlock(blocksize uint64) (string, []byte) {
 	guid := uuid.NewString()
 	block := make([]byte, blocksize)
 	file.cache[guid] = block
+	if file.written == nil {
+		file.written = make(map[string]bool)
+	}
+	file.written[guid] = true
 	return guid, block
 }
 
-func (file *File) write(c *PuddleStoreClient, offset uint64, data []byte) error {
+// dirtyBlocks returns the bytes to store for the blocks the inode references that were
+// written since the file was opened, keyed by GUID, and records how they were stored in
+// the inode. With Config.ContentAddressed, the blocks are renamed to the content keys of
+// their stored bytes first. Either way the inode has to be encoded after calling it.
+func (file *File) dirtyBlocks(c *PuddleStoreClient) (map[string][]byte, error) {
+	codec, err := lookupCodec(c.config.Codec)
+	if err != nil {
+		return nil, err
+	}
+	if file.aead == nil && c.masterKey != nil && len(file.written) > 0 {
+		// blocks stored before the file got its key stay readable in the clear
+		if file.aead, err = c.newFileKey(file.in); err != nil {
+			return nil, err
+		}
+	}
+	dirty := make(map[string][]byte, len(file.written))
+	for i, ref := range file.in.Blocks {
+		if !file.written[ref.GUID] {
+			continue
+		}
+		block := file.cache[ref.GUID]
+		data, name, err := encodeBlock(codec, block)
+		if err != nil {
+			return nil, err
+		}
+		if file.aead != nil {
+			if data, err = seal(file.aead, data, blockData(i, ref.GUID, c.config.ContentAddressed)); err != nil {
+				return nil, err
+			}
+			ref.Seal = true
+		}
+		if c.config.ContentAddressed {
+			ref.GUID = contentKey(data)
+			file.cache[ref.GUID] = block
+		}
+		ref.Sum = checksum(data)
+		ref.Codec = name
+		file.in.Blocks[i] = ref
+		dirty[ref.GUID] = data
+	}
+	return dirty, nil
+}
+
+func (file *File) write(ctx context.Context, c *PuddleStoreClient, offset uint64, data []byte) error {
+	if offset+uint64(len(data)) < offset {
+		// the end of the file would not fit in a uint64
+		return ErrFileTooLarge
+	}
+	file.dirty = true
 	pos := offset % c.config.BlockSize
 	bytes := 0
 	size := len(data)
-	blocknum := int(offset / c.config.BlockSize)
+	blocknum := offset / c.config.BlockSize
 
 	// fmt.Println("write: offset: ", offset, "size: ", size, "file size: ", file.in.Size)
 
 	for bytes < size {
-		var block []byte
-		var guid string
-		if blocknum < len(file.in.Blocks) {
-			guid, block = file.createNewBlock(c.config.BlockSize)
-			oldguid := file.in.Blocks[blocknum]
-			oldblk, ok := file.cache[oldguid]
-			if !ok {
-				var err error
-				oldblk, err = c.Get(oldguid)
-				if err != nil {
-					return err
-				}
+		// the blocks skipped by writing past the end stay holes
+		guid, block := file.createNewBlock(c.config.BlockSize)
+		if _, ok := file.in.Blocks[blocknum]; ok {
+			oldblk, err := file.fetchBlock(ctx, c, blocknum)
+			if err != nil {
+				return err
 			}
 			copy(block, oldblk)
-			// delete(file.cache, file.in.blocks[blocknum])
-			file.in.Blocks[blocknum] = guid
-		} else {
-			for blocknum >= len(file.in.Blocks) {
-				guid, block = file.createNewBlock(c.config.BlockSize)
-				file.in.Blocks = append(file.in.Blocks, guid)
-			}
 		}
+		// delete(file.cache, file.in.blocks[blocknum])
+		file.in.Blocks[blocknum] = blockRef{GUID: guid}
 
 		length := min(uint64(size-bytes), c.config.BlockSize-pos)
 
@@ -179,3 +563,130 @@ func (file *File) write(c *PuddleStoreClient, offset uint64, data []byte) error
 	}
 	return nil
 }
+
+// fetchBlock returns the content of block `i`, from the local cache if possible. Holes
+// read as a block of zero bytes and are never cached, since Close stores the cache.
+func (file *File) fetchBlock(ctx context.Context, c *PuddleStoreClient, i uint64) ([]byte, error) {
+	ref, ok := file.in.Blocks[i]
+	if !ok {
+		return make([]byte, c.config.BlockSize), nil
+	}
+	if block, ok := file.cache[ref.GUID]; ok {
+		return block, nil
+	}
+	data, err := file.storedBlock(ctx, c, i)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Seal {
+		if file.aead == nil {
+			return nil, ErrNoKey
+		}
+		// the checksum only covers accidents, this detects tampering
+		if data, err = open(file.aead, data, blockData(i, ref.GUID, strings.HasPrefix(ref.GUID, casPrefix))); err != nil {
+			return nil, &CorruptError{GUID: ref.GUID}
+		}
+	}
+	block, err := decodeBlock(ref, data)
+	if err != nil {
+		return nil, fmt.Errorf("block %s: %w", ref.GUID, err)
+	}
+	if uint64(len(block)) != c.config.BlockSize {
+		// a block stored with another block size passes its checksum, but reading it
+		// would run past its end
+		return nil, &CorruptError{GUID: ref.GUID}
+	}
+	file.cache[ref.GUID] = block
+	return block, nil
+}
+
+func (file *File) truncate(ctx context.Context, c *PuddleStoreClient, size uint64) error {
+	file.dirty = true
+	if size >= file.in.Size {
+		// the tail of the last block is always zero, so only whole blocks are missing, and
+		// they are holes
+		file.in.Size = size
+		return nil
+	}
+
+	blocknum := blockCount(size, c.config.BlockSize)
+	pos := size % c.config.BlockSize
+	if _, ok := file.in.Blocks[blocknum-1]; ok && pos != 0 {
+		// copy-on-write the last partial block with its tail zeroed
+		oldblk, err := file.fetchBlock(ctx, c, blocknum-1)
+		if err != nil {
+			return err
+		}
+		guid, block := file.createNewBlock(c.config.BlockSize)
+		copy(block[:pos], oldblk)
+		file.in.Blocks[blocknum-1] = blockRef{GUID: guid}
+	}
+	for i := range file.in.Blocks {
+		if i >= blocknum {
+			delete(file.in.Blocks, i)
+		}
+	}
+	file.in.Size = size
+	return nil
+}
+
+// punchHole zeroes `length` bytes from `offset`. Blocks the range covers entirely become
+// holes, the others are copied on write. The size of the file does not change.
+func (file *File) punchHole(ctx context.Context, c *PuddleStoreClient, offset, length uint64) error {
+	if offset >= file.in.Size {
+		return nil
+	}
+	file.dirty = true
+	if length > file.in.Size-offset {
+		length = file.in.Size - offset
+	}
+	end := offset + length
+	bs := c.config.BlockSize
+	// the blocks the range covers entirely, where the tail of the last block is always
+	// zero, so reaching the end covers it too
+	first := blockCount(offset, bs)
+	last := end / bs
+	if end == file.in.Size {
+		last = blockCount(end, bs)
+	}
+	for i := range file.in.Blocks {
+		if i >= first && i < last {
+			delete(file.in.Blocks, i)
+		}
+	}
+	// zero the partially covered blocks at either end with copy-on-write
+	partial := []uint64{offset / bs}
+	if end/bs != offset/bs {
+		partial = append(partial, end/bs)
+	}
+	for _, blocknum := range partial {
+		if blocknum >= first && blocknum < last {
+			continue
+		}
+		if _, ok := file.in.Blocks[blocknum]; !ok {
+			continue
+		}
+		// the end of the last block of a file that reaches the largest offset overflows
+		from, to := blocknum*bs, end
+		if from < offset {
+			from = offset
+		}
+		if end-blocknum*bs > bs {
+			to = blocknum*bs + bs
+		}
+		if from >= to {
+			continue
+		}
+		oldblk, err := file.fetchBlock(ctx, c, blocknum)
+		if err != nil {
+			return err
+		}
+		newguid, block := file.createNewBlock(bs)
+		copy(block, oldblk)
+		for i := from - blocknum*bs; i < to-blocknum*bs; i++ {
+			block[i] = 0
+		}
+		file.in.Blocks[blocknum] = blockRef{GUID: newguid}
+	}
+	return nil
+}
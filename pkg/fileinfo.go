@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// FileInfo describes a file or directory stored in puddlestore. It implements fs.FileInfo
+// so it can be handed to standard library code.
+type FileInfo struct {
+	name    string
+	size    uint64
+	isDir   bool
+	isLink  bool
+	blocks  int
+	nlink   int
+	uid     uint32
+	gid     uint32
+	perm    fs.FileMode
+	version int32
+	ctime   time.Time
+	mtime   time.Time
+	atime   time.Time
+}
+
+func newFileInfo(path string, in *inode, stat *zk.Stat) FileInfo {
+	return FileInfo{
+		name:    filepath.Base(path),
+		size:    in.Size,
+		isDir:   in.IsDir,
+		isLink:  in.IsSymlink,
+		blocks:  in.Allocated,
+		nlink:   int(in.Nlink),
+		uid:     in.Uid,
+		gid:     in.Gid,
+		perm:    fs.FileMode(in.Mode) & fs.ModePerm,
+		version: stat.Version,
+		ctime:   time.Unix(0, in.Ctime),
+		mtime:   time.Unix(0, in.Mtime),
+		atime:   time.Unix(0, in.Atime),
+	}
+}
+
+// Name returns the base name of the file
+func (fi FileInfo) Name() string { return fi.name }
+
+// Size returns the length of the file in bytes
+func (fi FileInfo) Size() int64 { return int64(fi.size) }
+
+// Mode returns the file mode bits
+func (fi FileInfo) Mode() fs.FileMode {
+	if fi.isDir {
+		return fs.ModeDir | fi.perm
+	}
+	if fi.isLink {
+		return fs.ModeSymlink | fi.perm
+	}
+	return fi.perm
+}
+
+// ModTime returns the time the content of the file, or the entries of the directory,
+// last changed
+func (fi FileInfo) ModTime() time.Time { return fi.mtime }
+
+// IsDir reports whether the path is a directory
+func (fi FileInfo) IsDir() bool { return fi.isDir }
+
+// Sys returns nil, there is no underlying data source
+func (fi FileInfo) Sys() interface{} { return nil }
+
+// Blocks returns the number of data blocks referenced by the inode, not counting holes
+func (fi FileInfo) Blocks() int { return fi.blocks }
+
+// Uid returns the user id of the owner
+func (fi FileInfo) Uid() uint32 { return fi.uid }
+
+// Gid returns the group id of the file
+func (fi FileInfo) Gid() uint32 { return fi.gid }
+
+// Links returns the number of names that refer to the inode
+func (fi FileInfo) Links() int { return fi.nlink }
+
+// Version returns the zookeeper version of the inode. It is bumped on every commit, but
+// also when a read updates the access time, which happens on the first read after a
+// modification and once a day after that. A changed version therefore means the inode
+// was written, not necessarily that its content changed; compare ModTime for that.
+func (fi FileInfo) Version() int32 { return fi.version }
+
+// CreateTime returns the time the file or directory was created
+func (fi FileInfo) CreateTime() time.Time { return fi.ctime }
+
+// AccessTime returns the time the file was last read. Like relatime, it is only updated
+// when it is older than the modification time or more than a day old.
+func (fi FileInfo) AccessTime() time.Time { return fi.atime }
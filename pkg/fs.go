@@ -0,0 +1,226 @@
+package pkg
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+)
+
+// FS is a read-only io/fs view of a puddlestore client. It implements fs.FS, fs.StatFS,
+// fs.ReadDirFS, fs.ReadFileFS and fs.SubFS, so puddlestore can be used with fs.WalkDir,
+// http.FS, template.ParseFS and similar code. Files are opened without write access,
+// so an open file holds a read lock until it is closed. A FS is safe for concurrent use,
+// for example by http.FileServerFS. Since a client is not, calls to it are serialized.
+type FS struct {
+	client Client
+	root   string
+	mu     *sync.Mutex // shared with the views returned by Sub, which use the same client
+}
+
+var (
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.SubFS      = (*FS)(nil)
+)
+
+// NewFS returns an io/fs view of the whole namespace of `client`
+func NewFS(client Client) *FS {
+	return &FS{client: client, root: "/", mu: new(sync.Mutex)}
+}
+
+// fullPath validates the io/fs `name` and translates it into a puddlestore path
+func (fsys *FS) fullPath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(fsys.root, name), nil
+}
+
+// fsError reports the client error `err` under the io/fs `name`
+func fsError(op, name string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// stat returns the FileInfo of `name`, named the way io/fs expects
+func (fsys *FS) stat(op, name string) (fs.FileInfo, error) {
+	full, err := fsys.fullPath(op, name)
+	if err != nil {
+		return nil, err
+	}
+	fsys.mu.Lock()
+	info, err := fsys.client.Stat(full)
+	fsys.mu.Unlock()
+	if err != nil {
+		return nil, fsError(op, name, err)
+	}
+	return namedInfo{info, path.Base(name)}, nil
+}
+
+// Open opens the file or directory `name` for reading
+func (fsys *FS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &fsDir{info: info, entries: entries}, nil
+	}
+
+	full, _ := fsys.fullPath("open", name)
+	fsys.mu.Lock()
+	h, err := fsys.client.OpenFile(full, OpenOptions{})
+	fsys.mu.Unlock()
+	if err != nil {
+		return nil, fsError("open", name, err)
+	}
+	return &fsFile{h: h, info: info, mu: fsys.mu}, nil
+}
+
+// Stat returns the FileInfo of `name`, following symbolic links
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.stat("stat", name)
+}
+
+// ReadDir returns the entries of the directory `name` sorted by file name
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := fsys.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	full, _ := fsys.fullPath("readdir", name)
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	names, err := fsys.client.List(full)
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+	sort.Strings(names)
+
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, child := range names {
+		// like os.ReadDir, symbolic links are listed as links, so fs.WalkDir does not
+		// descend into linked directories
+		childInfo, err := fsys.client.Lstat(path.Join(full, child))
+		if err != nil {
+			// removed since we listed the directory
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(childInfo))
+	}
+	return entries, nil
+}
+
+// ReadFile returns the whole content of the file `name`
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, ok := f.(*fsDir); ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	return io.ReadAll(f)
+}
+
+// Sub returns the view of the subtree rooted at the directory `dir`
+func (fsys *FS) Sub(dir string) (fs.FS, error) {
+	info, err := fsys.stat("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	full, _ := fsys.fullPath("sub", dir)
+	return &FS{client: fsys.client, root: full, mu: fsys.mu}, nil
+}
+
+// namedInfo overrides the name of a FileInfo, since the root of a FS is called "."
+type namedInfo struct {
+	FileInfo
+	name string
+}
+
+func (fi namedInfo) Name() string { return fi.name }
+
+// fsFile is a regular file opened through FS. It only exposes the read methods of its
+// handle, since FS is read-only.
+type fsFile struct {
+	h    *FileHandle
+	info fs.FileInfo
+	mu   *sync.Mutex // the mutex of the FS, since the handle calls its client
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.h.Read(p)
+}
+
+func (f *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.h.ReadAt(p, off)
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.h.Seek(offset, whence)
+}
+
+func (f *fsFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.h.Close()
+}
+
+// fsDir is a directory opened through FS. Its entries are read when it is opened.
+type fsDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (d *fsDir) Close() error { return nil }
+
+// ReadDir returns the next `n` entries, or all remaining ones if `n` <= 0
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
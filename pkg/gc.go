@@ -0,0 +1,349 @@
+package pkg
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// Tapestry cannot list the objects it stores, so every client records the blocks it is
+// about to store in a block journal under JOURNAL before storing them. The garbage
+// collector deletes the journaled blocks that no inode references anymore, and keeps the
+// referenced ones in compacted journal entries so they are collected once they die.
+const journalPrefix = "/j-"
+
+// journalChunk is the number of block GUIDs in one journal entry. An entry holds a twentieth
+// as many inodes, which have up to directBlocks references each.
+const journalChunk = 10000
+
+// DefaultGCGrace is the default age a journal entry needs before its blocks are collected
+const DefaultGCGrace = 10 * time.Minute
+
+// journal is the content of a journal entry
+type journal struct {
+	Blocks []string
+	// Inodes hold the blocks fields of inodes whose blocks are about to be referenced
+	// again. The collector expands them into blocks, pointer blocks and parity fragments.
+	Inodes []inode
+	// Committed entries are written by the collector and only hold blocks that were
+	// referenced by committed inodes, so they need no grace period
+	Committed bool
+}
+
+// GCOptions controls a garbage collection
+type GCOptions struct {
+	// DryRun only reports the garbage without deleting anything
+	DryRun bool
+	// Grace is the age a journal entry needs before its blocks are collected. It has to
+	// be longer than any Close takes to store its blocks and commit, since blocks that are
+	// stored but not committed yet are not referenced. Zero means DefaultGCGrace.
+	Grace time.Duration
+}
+
+// GCReport describes a garbage collection
+type GCReport struct {
+	// Live is the number of blocks and parity fragments referenced by files, snapshots and
+	// versions
+	Live int
+	// Checked is the number of journaled blocks that were old enough to be checked
+	Checked int
+	// Pending is the number of journaled blocks that were too young to be checked
+	Pending int
+	// Garbage lists the checked blocks that are not referenced. They were deleted from
+	// every tapestry node unless this was a dry run.
+	Garbage []string
+}
+
+// journalBlocks records in the block journal that `guids` are going to be stored
+func journalBlocks(guids []string, committed bool, zkConn *zk.Conn) error {
+	for len(guids) > 0 {
+		n := len(guids)
+		if n > journalChunk {
+			n = journalChunk
+		}
+		buf, err := encodeMsgPack(journal{Blocks: guids[:n], Committed: committed})
+		if err != nil {
+			return err
+		}
+		_, err = zkConn.Create(JOURNAL+journalPrefix, buf.Bytes(), zk.FlagSequence, zk.WorldACL(zk.PermAll))
+		if err != nil {
+			return err
+		}
+		guids = guids[n:]
+	}
+	return nil
+}
+
+// journalInodes records the blocks, pointer blocks and parity fragments of `ins` in the
+// block journal. Clone, Restore and Snapshot call it before making other inodes reference
+// them, since the collector may otherwise read the live set while the blocks move between
+// the inode table, snapshots and version histories, and miss them. Only the direct blocks
+// and the root of the pointer tree are journaled, so it costs no tapestry reads.
+func journalInodes(ins []*inode, zkConn *zk.Conn) error {
+	for len(ins) > 0 {
+		n := len(ins)
+		if n > journalChunk/20 {
+			n = journalChunk / 20
+		}
+		entry := journal{Inodes: make([]inode, 0, n)}
+		for _, in := range ins[:n] {
+			entry.Inodes = append(entry.Inodes, inode{
+				Size: in.Size, Blocks: in.Blocks, Erasure: in.Erasure, Indirect: in.Indirect, Depth: in.Depth,
+			})
+		}
+		buf, err := encodeMsgPack(entry)
+		if err != nil {
+			return err
+		}
+		_, err = zkConn.Create(JOURNAL+journalPrefix, buf.Bytes(), zk.FlagSequence, zk.WorldACL(zk.PermAll))
+		if err != nil {
+			return err
+		}
+		ins = ins[n:]
+	}
+	return nil
+}
+
+// CollectGarbage deletes the blocks that were stored in tapestry but are not referenced
+// by any file, snapshot or version from every tapestry node of the cluster. Only one
+// collection runs at a time.
+func (c *Cluster) CollectGarbage(opts GCOptions) (*GCReport, error) {
+	if opts.Grace == 0 {
+		opts.Grace = DefaultGCGrace
+	}
+	dlock := CreateDistLock(JOURNAL, c.zkConn)
+	if err := dlock.WriteLock(); err != nil {
+		return nil, err
+	}
+	defer dlock.Release()
+
+	// the journal is read before the live set, so every block of an entry we check was
+	// either committed before we look at the inodes, or is garbage
+	names, _, err := c.zkConn.Children(JOURNAL)
+	if err != nil {
+		return nil, err
+	}
+	report := &GCReport{Garbage: make([]string, 0)}
+	checked := make(map[string]bool)
+	pending := make(map[string]bool)
+	// pointer blocks of journaled inodes are read once however many entries share them
+	loaded := make(map[string][]pointerEntry)
+	addPending := func(entry journal) error {
+		for _, guid := range entry.Blocks {
+			pending[guid] = true
+		}
+		for i := range entry.Inodes {
+			if err := c.inodeBlocks(&entry.Inodes[i], loaded, pending); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var done []string
+	now := time.Now()
+	for _, name := range names {
+		path := JOURNAL + "/" + name
+		data, stat, err := c.zkConn.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		entry := journal{}
+		if err := decodeMsgPack(data, &entry); err != nil {
+			return nil, err
+		}
+		if !entry.Committed && now.Sub(time.Unix(0, stat.Ctime*int64(time.Millisecond))) < opts.Grace {
+			if err := addPending(entry); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// the blocks of old journaled inodes were journaled when they were stored
+		for _, guid := range entry.Blocks {
+			checked[guid] = true
+		}
+		done = append(done, path)
+	}
+	report.Checked = len(checked)
+
+	live, err := c.liveBlocks()
+	if err != nil {
+		return nil, err
+	}
+	report.Live = len(live)
+
+	// a Clone, Restore or Snapshot journals the inodes it copies before committing, so
+	// the entries added while we read the live set name every block that moved past us
+	listed := make(map[string]bool, len(names))
+	for _, name := range names {
+		listed[name] = true
+	}
+	names, _, err = c.zkConn.Children(JOURNAL)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if listed[name] {
+			continue
+		}
+		data, _, err := c.zkConn.Get(JOURNAL + "/" + name)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry := journal{}
+		if err := decodeMsgPack(data, &entry); err != nil {
+			return nil, err
+		}
+		if err := addPending(entry); err != nil {
+			return nil, err
+		}
+	}
+	for guid := range loaded {
+		pending[guid] = true
+	}
+	report.Pending = len(pending)
+
+	keep := make([]string, 0)
+	for guid := range checked {
+		if live[guid] {
+			keep = append(keep, guid)
+		} else if !pending[guid] {
+			report.Garbage = append(report.Garbage, guid)
+		}
+		// a content addressed block that is garbage but was stored again recently stays
+		// journaled by its pending entry
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	for _, guid := range report.Garbage {
+		for _, node := range c.nodes {
+			node.tap.Remove(guid)
+		}
+	}
+	// the compacted entries are written before the old ones are dropped, so a failure in
+	// between only leaves duplicates
+	if err := journalBlocks(keep, true, c.zkConn); err != nil {
+		return nil, err
+	}
+	for _, path := range done {
+		err := c.zkConn.Delete(path, -1)
+		if err != nil && err != zk.ErrNoNode {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// liveBlocks returns the set of blocks referenced by the inode table, snapshots and the
+// version histories, including their pointer blocks and parity fragments
+func (c *Cluster) liveBlocks() (map[string]bool, error) {
+	zkConn := c.zkConn
+	live := make(map[string]bool)
+	// pointer blocks are shared by clones, snapshots and versions, so each is read once
+	loaded := make(map[string][]pointerEntry)
+	add := func(path string) error {
+		data, _, err := zkConn.Get(path)
+		if err == zk.ErrNoNode {
+			// removed since we listed it, so it references nothing anymore
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		in, err := decodeInode(data)
+		if err != nil {
+			return err
+		}
+		return c.inodeBlocks(in, loaded, live)
+	}
+
+	inodes, _, err := zkConn.Children(INODES)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range inodes {
+		if err := add(INODES + "/" + name); err != nil {
+			return nil, err
+		}
+	}
+
+	snapshots, _, err := zkConn.Children(SNAPSHOTS)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range snapshots {
+		// pending snapshots count as well, since a snapshot that is being created is
+		// about to be committed
+		paths, err := subtree(snapshotPath(name), zkConn)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// the top znode of a snapshot holds the directory it was taken of
+		for _, path := range paths[1:] {
+			if err := add(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	histories, _, err := zkConn.Children(VERSIONS)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range histories {
+		versions, _, err := zkConn.Children(VERSIONS + "/" + dir)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range versions {
+			if err := add(VERSIONS + "/" + dir + "/" + name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for guid := range loaded {
+		live[guid] = true
+	}
+	return live, nil
+}
+
+// inodeBlocks adds the blocks and parity fragments of `in` to `set`. The pointer blocks it
+// reads end up in `loaded`, which the caller adds once it is done.
+func (c *Cluster) inodeBlocks(in *inode, loaded map[string][]pointerEntry, set map[string]bool) error {
+	if err := loadBlocks(in, c.config.BlockSize, c.getPointers, loaded); err != nil {
+		return err
+	}
+	for _, ref := range in.Blocks {
+		if !ref.isHole() {
+			set[ref.GUID] = true
+		}
+	}
+	for _, key := range parityKeys(in) {
+		set[key] = true
+	}
+	return nil
+}
+
+// getPointers returns an intact copy of the pointer block `ref` from any tapestry node.
+// A pointer block that cannot be read makes the collection fail, since the blocks it lists
+// would look like garbage.
+func (c *Cluster) getPointers(ref blockRef) ([]byte, error) {
+	for _, node := range c.nodes {
+		data, err := node.tap.Get(ref.GUID)
+		if err == nil && ref.intact(data) {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("pointer block %s: %w", ref.GUID, ErrNoReplicas)
+}
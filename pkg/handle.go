@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// FileHandle is a file opened with `OpenFile`. It keeps its own cursor and implements
+// io.Reader, io.Writer, io.Seeker, io.ReaderAt, io.WriterAt and io.Closer on top of the
+// file descriptor API, so it can be used with io.Copy, bufio and friends. Like the file
+// descriptors it wraps, a FileHandle must not be used from several goroutines at once.
+// Once it is closed, all its methods fail with fs.ErrClosed.
+type FileHandle struct {
+	client *PuddleStoreClient
+	fd     int // -1 once closed, since the client hands the descriptor out again
+	name   string
+	offset int64
+}
+
+var (
+	_ io.ReadWriteSeeker = (*FileHandle)(nil)
+	_ io.ReaderAt        = (*FileHandle)(nil)
+	_ io.WriterAt        = (*FileHandle)(nil)
+	_ io.Closer          = (*FileHandle)(nil)
+)
+
+// `OpenFile` opens a file like `OpenWith` and wraps the file descriptor in a FileHandle.
+func (c *PuddleStoreClient) OpenFile(path string, opts OpenOptions) (*FileHandle, error) {
+	return c.OpenFileContext(context.Background(), path, opts)
+}
+
+// `OpenFileContext` is `OpenFile` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) OpenFileContext(ctx context.Context, path string, opts OpenOptions) (*FileHandle, error) {
+	fd, err := c.OpenWithContext(ctx, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &FileHandle{client: c, fd: fd, name: path}, nil
+}
+
+// Name returns the path the file was opened with
+func (h *FileHandle) Name() string { return h.name }
+
+// Fd returns the underlying file descriptor, or -1 once the handle is closed
+func (h *FileHandle) Fd() int { return h.fd }
+
+// closed returns the error of `op` on a closed handle, or nil if it is open
+func (h *FileHandle) closed(op string) error {
+	if h.fd < 0 {
+		return &fs.PathError{Op: op, Path: h.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+// Read reads up to len(p) bytes at the cursor and advances it. It returns io.EOF once the
+// cursor is at or past the end of the file.
+func (h *FileHandle) Read(p []byte) (int, error) {
+	n, err := h.ReadAt(p, h.offset)
+	h.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt reads len(p) bytes starting at `off` without moving the cursor. Like
+// io.ReaderAt requires, it returns io.EOF when fewer than len(p) bytes are available.
+func (h *FileHandle) ReadAt(p []byte, off int64) (int, error) {
+	if err := h.closed("read"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, errors.New("readat: negative offset")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	data, err := h.client.Read(h.fd, uint64(off), uint64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes p at the cursor and advances it
+func (h *FileHandle) Write(p []byte) (int, error) {
+	n, err := h.WriteAt(p, h.offset)
+	h.offset += int64(n)
+	return n, err
+}
+
+// WriteAt writes p starting at `off` without moving the cursor
+func (h *FileHandle) WriteAt(p []byte, off int64) (int, error) {
+	if err := h.closed("write"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, errors.New("writeat: negative offset")
+	}
+	if err := h.client.Write(h.fd, uint64(off), p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Seek sets the cursor for the next Read or Write. io.SeekEnd is relative to the size
+// of the file including writes that are not flushed yet.
+func (h *FileHandle) Seek(offset int64, whence int) (int64, error) {
+	if err := h.closed("seek"); err != nil {
+		return 0, err
+	}
+	var base int64
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		base = h.offset
+	case io.SeekEnd:
+		file, ok := h.client.files[h.fd]
+		if !ok {
+			return 0, fmt.Errorf("seek: %w", ErrBadFd)
+		}
+		base = int64(file.in.Size)
+	default:
+		return 0, fmt.Errorf("seek: invalid whence %d", whence)
+	}
+	if base+offset < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+	h.offset = base + offset
+	return h.offset, nil
+}
+
+// Close closes the file and flushes its contents, see `Close`. The handle is closed even
+// if flushing fails.
+func (h *FileHandle) Close() error {
+	if err := h.closed("close"); err != nil {
+		return err
+	}
+	fd := h.fd
+	h.fd = -1
+	return h.client.Close(fd)
+}
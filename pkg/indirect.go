@@ -0,0 +1,219 @@
+package pkg
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Only the first directBlocks block references of a file live in its inode. The others
+// are listed by a tree of pointer blocks, which the inode points to with Indirect. A
+// pointer block of the lowest level lists up to pointersPerBlock blocks, and a pointer
+// block of any other level lists up to pointersPerBlock pointer blocks of the level below.
+// The tree gets as many levels as the last allocated block needs, which is at most
+// maxDepth for any block number a uint64 can hold, so the block size does not limit the
+// size of a file. Holes are left out of all lists, and a pointer block that would only
+// list holes is left out as well. Pointer blocks are stored in tapestry like data blocks
+// and never change, so a commit stores new ones for the lists that changed, and clones,
+// snapshots and versions share them. This keeps the inode in zookeeper at a constant size
+// whatever the length of the file.
+const (
+	directBlocks     = 12
+	pointerBits      = 10
+	pointersPerBlock = 1 << pointerBits
+	maxDepth         = (64 + pointerBits - 1) / pointerBits
+)
+
+// blockMap holds the block references of a file by block number. Holes are left out, so
+// they cost nothing however many a sparse file has.
+type blockMap map[uint64]blockRef
+
+func (m blockMap) clone() blockMap {
+	c := make(blockMap, len(m))
+	for i, ref := range m {
+		c[i] = ref
+	}
+	return c
+}
+
+// pointerEntry is the reference at position Slot of the list a pointer block covers.
+// Pointer blocks hold entries for the positions that are not holes only, in order.
+type pointerEntry struct {
+	Slot uint64
+	Ref  blockRef
+}
+
+// blockCount returns the number of block references of a file of `size` bytes
+func blockCount(size, blocksize uint64) uint64 {
+	n := size / blocksize
+	if size%blocksize != 0 {
+		n++
+	}
+	return n
+}
+
+// loadBlocks adds all blocks of `in` to its direct blocks, reading the pointer blocks with
+// `get`. The entries of the pointer blocks it reads are added to `loaded` by GUID, and
+// pointer blocks already in `loaded` are not read again.
+func loadBlocks(in *inode, blocksize uint64, get func(blockRef) ([]byte, error), loaded map[string][]pointerEntry) error {
+	if in.Blocks == nil {
+		in.Blocks = make(blockMap)
+	}
+	if in.Indirect.isHole() {
+		return nil
+	}
+	if in.Depth < 1 || in.Depth > maxDepth {
+		return &CorruptError{GUID: in.Indirect.GUID}
+	}
+	n := blockCount(in.Size, blocksize)
+	var walk func(ref blockRef, level int, prefix uint64) error
+	walk = func(ref blockRef, level int, prefix uint64) error {
+		list, ok := loaded[ref.GUID]
+		if !ok {
+			data, err := get(ref)
+			if err != nil {
+				return err
+			}
+			if err := decodeMsgPack(data, &list); err != nil {
+				return &CorruptError{GUID: ref.GUID}
+			}
+			loaded[ref.GUID] = list
+		}
+		for i, e := range list {
+			// a key that overflows a uint64 cannot be a block number either
+			if e.Slot >= pointersPerBlock || e.Ref.isHole() || (i > 0 && e.Slot <= list[i-1].Slot) ||
+				prefix>>(64-pointerBits) != 0 {
+				return &CorruptError{GUID: ref.GUID}
+			}
+			key := prefix<<pointerBits | e.Slot
+			if level > 1 {
+				if err := walk(e.Ref, level-1, key); err != nil {
+					return err
+				}
+				continue
+			}
+			if n <= directBlocks || key >= n-directBlocks {
+				return &CorruptError{GUID: ref.GUID}
+			}
+			in.Blocks[directBlocks+key] = e.Ref
+		}
+		return nil
+	}
+	return walk(in.Indirect, in.Depth, 0)
+}
+
+// packBlocks is the reverse of loadBlocks. It leaves the direct blocks in `in`, points
+// Indirect at the root of a tree of pointer blocks listing the others, and returns the
+// pointer blocks that have to be stored, keyed by GUID. A pointer block whose list
+// equals the one `loaded` holds for the pointer block at its place in the tree the file
+// was loaded with is kept.
+func packBlocks(in *inode, contentAddressed bool, loaded map[string][]pointerEntry) (map[string][]byte, error) {
+	// a pointer block is placed by its level and the block numbers it covers, which do
+	// not change when the tree grows or shrinks
+	type place struct {
+		level  int
+		prefix uint64
+	}
+	old := make(map[place]blockRef)
+	var index func(ref blockRef, level int, prefix uint64)
+	index = func(ref blockRef, level int, prefix uint64) {
+		list, ok := loaded[ref.GUID]
+		if !ok {
+			return
+		}
+		old[place{level, prefix}] = ref
+		for _, e := range list {
+			if level > 1 {
+				index(e.Ref, level-1, prefix<<pointerBits|e.Slot)
+			}
+		}
+	}
+	if !in.Indirect.isHole() {
+		index(in.Indirect, in.Depth, 0)
+	}
+
+	stored := make(map[string][]byte)
+	pointer := func(prev blockRef, list []pointerEntry) (blockRef, error) {
+		if prevList, ok := loaded[prev.GUID]; ok && equalEntries(prevList, list) {
+			return prev, nil
+		}
+		buf, err := encodeMsgPack(list)
+		if err != nil {
+			return blockRef{}, err
+		}
+		data := buf.Bytes()
+		guid := uuid.NewString()
+		if contentAddressed {
+			guid = contentKey(data)
+		}
+		stored[guid] = data
+		return blockRef{GUID: guid, Sum: checksum(data)}, nil
+	}
+
+	in.Allocated = len(in.Blocks)
+	direct := make(blockMap)
+	// entries are keyed by the block number past the direct blocks at first, and by the
+	// prefix of the pointer blocks of the level below afterwards
+	var entries []pointerEntry
+	for i, ref := range in.Blocks {
+		if i < directBlocks {
+			direct[i] = ref
+		} else {
+			entries = append(entries, pointerEntry{Slot: i - directBlocks, Ref: ref})
+		}
+	}
+	in.Blocks = direct
+	if len(entries) == 0 {
+		in.Indirect, in.Depth = blockRef{}, 0
+		return stored, nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Slot < entries[j].Slot })
+	depth := 1
+	for depth < maxDepth && entries[len(entries)-1].Slot>>(pointerBits*depth) != 0 {
+		depth++
+	}
+
+	for level := 1; level <= depth; level++ {
+		var next []pointerEntry
+		for start := 0; start < len(entries); {
+			prefix := entries[start].Slot >> pointerBits
+			var list []pointerEntry
+			end := start
+			for ; end < len(entries) && entries[end].Slot>>pointerBits == prefix; end++ {
+				list = append(list, pointerEntry{Slot: entries[end].Slot & (pointersPerBlock - 1), Ref: entries[end].Ref})
+			}
+			ref, err := pointer(old[place{level, prefix}], list)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, pointerEntry{Slot: prefix, Ref: ref})
+			start = end
+		}
+		entries = next
+	}
+	in.Indirect, in.Depth = entries[0].Ref, depth
+	return stored, nil
+}
+
+func equalEntries(a, b []pointerEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// loadTree loads all blocks of `in` through the client, see loadBlocks, and returns the
+// lists of the pointer blocks it read
+func (c *PuddleStoreClient) loadTree(ctx context.Context, in *inode) (map[string][]pointerEntry, error) {
+	loaded := make(map[string][]pointerEntry)
+	err := loadBlocks(in, c.config.BlockSize, func(ref blockRef) ([]byte, error) {
+		return c.getBlock(ctx, ref)
+	}, loaded)
+	return loaded, err
+}
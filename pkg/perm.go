@@ -0,0 +1,79 @@
+package pkg
+
+import "io/fs"
+
+const (
+	permExec  = 1
+	permWrite = 2
+	permRead  = 4
+)
+
+// default permission bits of the root directory
+const rootMode = 0777
+
+// Identity is the user a client acts as. It is checked against the owner, group and mode
+// bits of every inode the client touches. The zero value is the superuser, who bypasses
+// all permission checks.
+type Identity struct {
+	Uid    uint32
+	Gid    uint32
+	Groups []uint32
+	// Umask clears permission bits of newly created files and directories
+	Umask uint32
+}
+
+// Root is the superuser identity, used by clients created without an explicit identity
+var Root = Identity{}
+
+func (id Identity) isRoot() bool {
+	return id.Uid == 0
+}
+
+func (id Identity) inGroup(gid uint32) bool {
+	if id.Gid == gid {
+		return true
+	}
+	for _, g := range id.Groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// permits reports whether `id` has all of the `want` permissions (a mask of permRead,
+// permWrite and permExec) on the inode, picking the owner, group or other class like POSIX
+func (in *inode) permits(id Identity, want uint32) bool {
+	if id.isRoot() {
+		return true
+	}
+	mode := in.Mode
+	switch {
+	case id.Uid == in.Uid:
+		mode >>= 6
+	case id.inGroup(in.Gid):
+		mode >>= 3
+	}
+	return mode&want == want
+}
+
+// inherit fills in the owner, group and mode of a new inode created by `id` inside the
+// directory `parent`. New entries take the group and permission bits of their parent,
+// minus the umask; files additionally drop all execute bits.
+func (in *inode) inherit(id Identity, parent *inode) {
+	in.Uid = id.Uid
+	in.Gid = parent.Gid
+	switch {
+	case in.IsSymlink:
+		in.Mode = 0777
+	case in.IsDir:
+		in.Mode = parent.Mode &^ id.Umask
+	default:
+		in.Mode = parent.Mode &^ id.Umask &^ 0111
+	}
+}
+
+// errPermission reports that the client may not `op` the user path `path`
+func errPermission(op, path string) error {
+	return &fs.PathError{Op: op, Path: path, Err: ErrPermission}
+}
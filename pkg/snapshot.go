@@ -0,0 +1,404 @@
+package pkg
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// snapshot is the content of the znode of a snapshot under SNAPSHOTS. The children of
+// that znode mirror the tree the snapshot was taken of, and each of them holds a frozen
+// copy of the inode of its entry. Blocks are never modified in place, so the frozen
+// inodes stay readable after the live files change.
+type snapshot struct {
+	Dir  string // user path of the directory the snapshot was taken of
+	Time int64  // unix nanoseconds
+	Uid  uint32 // creator
+	Root inode
+	// Pending is set while the snapshot is created or deleted, which takes several
+	// transactions. Pending snapshots are hidden from everything but DeleteSnapshot.
+	Pending bool
+}
+
+// snapshotBatch is the number of bytes one transaction of a snapshot writes or deletes
+const snapshotBatch = 256 * 1024
+
+// SnapshotInfo describes a snapshot
+type SnapshotInfo struct {
+	Name string
+	Dir  string
+	Time time.Time
+}
+
+func snapshotPath(name string) string {
+	return SNAPSHOTS + "/" + name
+}
+
+func checkSnapshotName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return fs.ErrInvalid
+	}
+	return nil
+}
+
+func decodeSnapshot(data []byte) (*snapshot, error) {
+	snap := &snapshot{}
+	err := decodeMsgPack(data, snap)
+	return snap, err
+}
+
+// multiBatched runs `ops` in order, in as many transactions as it takes to keep each of
+// them below snapshotBatch bytes
+func multiBatched(ctx context.Context, ops []interface{}, zkConn *zk.Conn) error {
+	batch := make([]interface{}, 0)
+	size := 0
+	for i, op := range ops {
+		switch req := op.(type) {
+		case *zk.CreateRequest:
+			size += len(req.Path) + len(req.Data)
+		case *zk.DeleteRequest:
+			size += len(req.Path)
+		}
+		batch = append(batch, op)
+		if size < snapshotBatch && i < len(ops)-1 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := zkConn.Multi(batch...); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		size = 0
+	}
+	return nil
+}
+
+// dropSnapshot deletes all znodes of the snapshot `name`, deepest first. The snapshot
+// has to be pending, so nobody reads it while it is only partly deleted.
+func dropSnapshot(ctx context.Context, name string, zkConn *zk.Conn) error {
+	paths, err := subtree(snapshotPath(name), zkConn)
+	if err != nil {
+		return err
+	}
+	ops := make([]interface{}, 0, len(paths))
+	for i := len(paths) - 1; i >= 0; i-- {
+		ops = append(ops, &zk.DeleteRequest{Path: paths[i], Version: -1})
+	}
+	return multiBatched(ctx, ops, zkConn)
+}
+
+// `Snapshot` captures the tree under the directory `dir` as the read-only snapshot
+// `name`. The snapshot shares all blocks with the live files, so it only costs zookeeper
+// space. Files inside it are opened with the Snapshot option of `OpenWith`.
+func (c *PuddleStoreClient) Snapshot(dir, name string) error {
+	return c.SnapshotContext(context.Background(), dir, name)
+}
+
+// `SnapshotContext` is `Snapshot` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) SnapshotContext(ctx context.Context, dir, name string) (err error) {
+	defer func(name string) { err = pathError("snapshot", name, err) }(dir)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+	path, err := c.resolve(ctx, dir, true)
+	if err != nil {
+		return err
+	}
+
+	// the frozen inodes are journaled before a writer can replace them, and no collection
+	// may read the live set in between, or it could miss blocks only they reference
+	jlock := CreateDistLock(JOURNAL, c.zkConn)
+	if err := jlock.ReadLockContext(ctx); err != nil {
+		return err
+	}
+	journaled := false
+	defer func() {
+		if !journaled {
+			jlock.Release()
+		}
+	}()
+
+	// read locks on the directories keep the tree from changing while it is copied. Files
+	// are committed atomically, so each frozen inode is a version that was committed.
+	tree, locks, err := lockTree(ctx, path, false, c.zkConn)
+	if err != nil {
+		return err
+	}
+	defer releaseLocks(locks)
+
+	ops := make([]interface{}, 0, len(tree))
+	frozen := make([]*inode, 0, len(tree))
+	snap := snapshot{Dir: userPath(path), Time: time.Now().UnixNano(), Uid: c.ident.Uid}
+	for _, node := range tree {
+		ent, err := decodeDirent(node.data)
+		if err != nil {
+			return err
+		}
+		in, _, err := readInode(ctx, ent.Ino, c.zkConn)
+		if err != nil {
+			return err
+		}
+		if node.path == path {
+			if !in.IsDir {
+				return ErrNotDir
+			}
+			if !in.permits(c.ident, permRead|permExec) {
+				return errPermission("snapshot", userPath(path))
+			}
+			snap.Root = *in
+			continue
+		}
+		if !in.IsDir {
+			frozen = append(frozen, in)
+		}
+		data, err := encodeInode(*in)
+		if err != nil {
+			return err
+		}
+		newPath := snapshotPath(name) + strings.TrimPrefix(node.path, path)
+		ops = append(ops, &zk.CreateRequest{Path: newPath, Data: data, Acl: zk.WorldACL(zk.PermAll)})
+	}
+
+	if err := journalInodes(frozen, c.zkConn); err != nil {
+		return err
+	}
+	journaled = true
+	jlock.Release()
+
+	// a large tree does not fit in one transaction, so the entries are written below a
+	// pending snapshot, which is made visible once all of them are written
+	snap.Pending = true
+	buf, err := encodeMsgPack(snap)
+	if err != nil {
+		return err
+	}
+	_, err = c.zkConn.Create(snapshotPath(name), buf.Bytes(), 0, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNodeExists {
+		return &fs.PathError{Op: "snapshot", Path: name, Err: ErrExist}
+	}
+	if err != nil {
+		return err
+	}
+	if err := multiBatched(ctx, ops, c.zkConn); err != nil {
+		dropSnapshot(context.Background(), name, c.zkConn)
+		return err
+	}
+	snap.Pending = false
+	buf, err = encodeMsgPack(snap)
+	if err != nil {
+		return err
+	}
+	// a DeleteSnapshot of the pending snapshot makes the commit fail
+	_, err = c.zkConn.Set(snapshotPath(name), buf.Bytes(), 0)
+	return err
+}
+
+// `ListSnapshots` describes all snapshots, sorted by name.
+func (c *PuddleStoreClient) ListSnapshots() ([]SnapshotInfo, error) {
+	return c.ListSnapshotsContext(context.Background())
+}
+
+// `ListSnapshotsContext` is `ListSnapshots` with a context that bounds remote calls.
+func (c *PuddleStoreClient) ListSnapshotsContext(ctx context.Context) ([]SnapshotInfo, error) {
+	if c.zkConn == nil {
+		return nil, ErrClientClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	names, _, err := c.zkConn.Children(SNAPSHOTS)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	infos := make([]SnapshotInfo, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, _, err := c.zkConn.Get(snapshotPath(name))
+		if err == zk.ErrNoNode {
+			// deleted since we listed the snapshots
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		snap, err := decodeSnapshot(data)
+		if err != nil {
+			return nil, err
+		}
+		if snap.Pending {
+			continue
+		}
+		infos = append(infos, SnapshotInfo{Name: name, Dir: snap.Dir, Time: time.Unix(0, snap.Time)})
+	}
+	return infos, nil
+}
+
+// `DeleteSnapshot` deletes the snapshot `name`. Only its creator and the superuser may
+// delete it. A snapshot that failed half way through its creation or deletion is deleted
+// the same way.
+func (c *PuddleStoreClient) DeleteSnapshot(name string) error {
+	return c.DeleteSnapshotContext(context.Background(), name)
+}
+
+// `DeleteSnapshotContext` is `DeleteSnapshot` with a context that bounds remote calls.
+func (c *PuddleStoreClient) DeleteSnapshotContext(ctx context.Context, name string) (err error) {
+	defer func(name string) { err = pathError("deletesnapshot", name, err) }(name)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	if err := checkSnapshotName(name); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, stat, err := c.zkConn.Get(snapshotPath(name))
+	if err != nil {
+		return err
+	}
+	snap, err := decodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+	if !c.ident.isRoot() && c.ident.Uid != snap.Uid {
+		return errPermission("deletesnapshot", name)
+	}
+
+	// hiding the snapshot first makes the deletion look atomic, however many transactions
+	// it takes. A concurrent delete of the same snapshot makes this fail.
+	if !snap.Pending {
+		snap.Pending = true
+		buf, err := encodeMsgPack(snap)
+		if err != nil {
+			return err
+		}
+		_, err = c.zkConn.Set(snapshotPath(name), buf.Bytes(), stat.Version)
+		if err == zk.ErrBadVersion {
+			return ErrNotExist
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return dropSnapshot(ctx, name, c.zkConn)
+}
+
+// subtree returns `path` and the paths of all znodes below it in pre-order
+func subtree(path string, zkConn *zk.Conn) ([]string, error) {
+	paths := []string{path}
+	children, _, err := zkConn.Children(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		sub, err := subtree(path+"/"+child, zkConn)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, sub...)
+	}
+	return paths, nil
+}
+
+// lookupSnapshot returns the frozen inode of `path` inside the snapshot `name`. Every
+// directory walked through needs execute permission. Symbolic links inside snapshots are
+// not followed.
+func (c *PuddleStoreClient) lookupSnapshot(ctx context.Context, name, path string) (*inode, error) {
+	if err := checkSnapshotName(name); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, _, err := c.zkConn.Get(snapshotPath(name))
+	if err != nil {
+		return nil, err
+	}
+	snap, err := decodeSnapshot(data)
+	if err != nil {
+		return nil, err
+	}
+	if snap.Pending {
+		return nil, ErrNotExist
+	}
+
+	in := &snap.Root
+	cur := snapshotPath(name)
+	for _, part := range strings.Split(filepath.Clean(path), "/") {
+		if part == "" {
+			continue
+		}
+		if !in.IsDir {
+			return nil, ErrNotDir
+		}
+		if !in.permits(c.ident, permExec) {
+			return nil, errPermission("lookup", filepath.Join(snap.Dir, strings.TrimPrefix(cur, snapshotPath(name))))
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		cur = cur + "/" + part
+		data, _, err := c.zkConn.Get(cur)
+		if err != nil {
+			return nil, err
+		}
+		if in, err = decodeInode(data); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// openSnapshot opens the file at `path` inside the snapshot `name` for reading. The file
+// has no lock since it never changes.
+func (c *PuddleStoreClient) openSnapshot(ctx context.Context, name, path string, opts OpenOptions) (int, error) {
+	if opts.Create || opts.Write {
+		return -1, ErrPermission
+	}
+	in, err := c.lookupSnapshot(ctx, name, path)
+	if err != nil {
+		return -1, err
+	}
+	if in.IsDir {
+		return -1, ErrIsDir
+	}
+	if in.IsSymlink {
+		return -1, fs.ErrInvalid
+	}
+	if !in.permits(c.ident, permRead) {
+		return -1, errPermission("open", path)
+	}
+
+	aead, err := c.fileKey(in)
+	if err != nil {
+		return -1, err
+	}
+	if _, err := c.loadTree(ctx, in); err != nil {
+		return -1, err
+	}
+
+	fd := c.generateNewFd()
+	c.files[fd] = &File{
+		flags:  O_READ,
+		in:     in,
+		cache:  make(map[string][]byte),
+		frozen: true,
+		aead:   aead,
+		base:   in.Blocks,
+	}
+	return fd, nil
+}
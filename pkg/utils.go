@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
@@ -52,6 +53,22 @@ func decodeInode(data []byte) (*inode, error) {
 	return &in, nil
 }
 
+func encodeDirent(ent dirent) ([]byte, error) {
+	buf, err := encodeMsgPack(ent)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeDirent(data []byte) (*dirent, error) {
+	var ent dirent
+	if err := decodeMsgPack(data, &ent); err != nil {
+		return nil, err
+	}
+	return &ent, nil
+}
+
 func randomIndexGenerator(min int, max int) int {
 	return rand.Intn(max-min) + min
 }
@@ -101,6 +118,22 @@ func cleanup(conn *zk.Conn) error {
 	if err != nil {
 		return err
 	}
+	err = recursiveDelete(conn, INODES)
+	if err != nil {
+		return err
+	}
+	err = recursiveDelete(conn, SNAPSHOTS)
+	if err != nil {
+		return err
+	}
+	err = recursiveDelete(conn, VERSIONS)
+	if err != nil {
+		return err
+	}
+	err = recursiveDelete(conn, JOURNAL)
+	if err != nil {
+		return err
+	}
 	err = recursiveDelete(conn, LOCK)
 	if err != nil {
 		return err
@@ -131,3 +164,21 @@ func recursiveDelete(conn *zk.Conn, path string) error {
 	}
 	return nil
 }
+
+// withContext runs `op` and returns its error, or ctx.Err() if ctx is done first. `op`
+// keeps running after an early return, so it must not touch anything the caller reuses.
+func withContext(ctx context.Context, op func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- op()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
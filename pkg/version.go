@@ -0,0 +1,280 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+// The version history of inode `ino` lives under versionDir(ino). Each committed change of
+// the content adds a sequential znode holding the inode it replaced, and only the newest
+// Config.MaxVersions of them are kept. Versions are numbered from 1, in the order they
+// were replaced.
+const versionPrefix = "/v-"
+
+// VersionInfo describes a previous version of a file
+type VersionInfo struct {
+	Version int
+	Size    uint64
+	ModTime time.Time
+}
+
+func versionDir(ino uint64) string {
+	return fmt.Sprintf("%s/%010d", VERSIONS, ino)
+}
+
+func versionPath(ino uint64, version int) string {
+	return fmt.Sprintf("%s%s%010d", versionDir(ino), versionPrefix, version-1)
+}
+
+// versionNumber returns the version number of the history znode called `name`
+func versionNumber(name string) (int, error) {
+	seq, err := strconv.Atoi(strings.TrimPrefix(name, versionPrefix[1:]))
+	return seq + 1, err
+}
+
+// dropVersions deletes the version history of inode `ino`, ignoring errors since the
+// history is useless once the inode is gone
+func dropVersions(ino uint64, zkConn *zk.Conn) {
+	recursiveDelete(zkConn, versionDir(ino))
+}
+
+// commitVersioned sets the inode at `path` to `data` and keeps the inode it replaces in the
+// version history. The caller must hold the write lock of the inode.
+func (c *PuddleStoreClient) commitVersioned(path string, data []byte) error {
+	if c.config.MaxVersions <= 0 {
+		_, err := c.zkConn.Set(path, data, -1)
+		return err
+	}
+	ino, err := inodeNumber(path)
+	if err != nil {
+		return err
+	}
+	old, stat, err := c.zkConn.Get(path)
+	if err != nil {
+		return err
+	}
+	dir := versionDir(ino)
+	_, err = c.zkConn.Create(dir, []byte{}, 0, zk.WorldACL(zk.PermAll))
+	if err != nil && err != zk.ErrNodeExists {
+		return err
+	}
+	_, err = c.zkConn.Multi(
+		&zk.CreateRequest{Path: dir + versionPrefix, Data: old, Acl: zk.WorldACL(zk.PermAll), Flags: zk.FlagSequence},
+		&zk.SetDataRequest{Path: path, Data: data, Version: stat.Version},
+	)
+	if err != nil {
+		return err
+	}
+
+	// sequence numbers are zero padded, so the oldest versions sort first
+	names, _, err := c.zkConn.Children(dir)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for i := 0; i < len(names)-c.config.MaxVersions; i++ {
+		err := c.zkConn.Delete(dir+"/"+names[i], -1)
+		if err != nil && err != zk.ErrNoNode {
+			return err
+		}
+	}
+	return nil
+}
+
+// `ListVersions` describes the previous versions of the file at `path` that are still
+// kept, oldest first. Each Close that changed the file adds the content it replaced.
+func (c *PuddleStoreClient) ListVersions(path string) ([]VersionInfo, error) {
+	return c.ListVersionsContext(context.Background(), path)
+}
+
+// `ListVersionsContext` is `ListVersions` with a context that bounds remote calls.
+func (c *PuddleStoreClient) ListVersionsContext(ctx context.Context, path string) (infos []VersionInfo, err error) {
+	defer func(name string) { err = pathError("listversions", name, err) }(path)
+	if c.zkConn == nil {
+		return nil, ErrClientClosed
+	}
+	ino, err := c.versionedIno(ctx, "listversions", path, permRead)
+	if err != nil {
+		return nil, err
+	}
+
+	names, _, err := c.zkConn.Children(versionDir(ino))
+	if err == zk.ErrNoNode {
+		return []VersionInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	infos = make([]VersionInfo, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, _, err := c.zkConn.Get(versionDir(ino) + "/" + name)
+		if err == zk.ErrNoNode {
+			// pruned since we listed the versions
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		in, err := decodeInode(data)
+		if err != nil {
+			return nil, err
+		}
+		version, err := versionNumber(name)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, VersionInfo{Version: version, Size: in.Size, ModTime: time.Unix(0, in.Mtime)})
+	}
+	return infos, nil
+}
+
+// `Restore` makes the content of the previous version `version` of the file at `path`
+// current again. The content it replaces becomes a version itself.
+func (c *PuddleStoreClient) Restore(path string, version int) error {
+	return c.RestoreContext(context.Background(), path, version)
+}
+
+// `RestoreContext` is `Restore` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) RestoreContext(ctx context.Context, path string, version int) (err error) {
+	defer func(name string) { err = pathError("restore", name, err) }(path)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	path, err = c.resolve(ctx, path, true)
+	if err != nil {
+		return err
+	}
+	ino, err := lookupIno(ctx, path, c.zkConn)
+	if err != nil {
+		return err
+	}
+	dlock := CreateDistLock(inodePath(ino), c.zkConn)
+	if err := dlock.WriteLockContext(ctx); err != nil {
+		return err
+	}
+	defer dlock.Release()
+
+	in, _, err := readInode(ctx, ino, c.zkConn)
+	if err != nil {
+		return err
+	}
+	if in.IsDir {
+		return ErrIsDir
+	}
+	if !in.permits(c.ident, permWrite) {
+		return errPermission("restore", userPath(path))
+	}
+	data, _, err := c.zkConn.Get(versionPath(ino, version))
+	if err != nil {
+		return err
+	}
+	old, err := decodeInode(data)
+	if err != nil {
+		return err
+	}
+	if err := journalInodes([]*inode{old}, c.zkConn); err != nil {
+		return err
+	}
+
+	// only the content is restored, the names, owner and attributes stay as they are
+	in.Size = old.Size
+	in.Blocks = old.Blocks
+	in.Erasure = old.Erasure
+	in.Indirect = old.Indirect
+	in.Depth = old.Depth
+	in.Allocated = old.Allocated
+	if in.Key == nil {
+		// the data key never changes once a file has one, so older versions either have
+		// the same key or only clear blocks
+		in.Key = old.Key
+	}
+	in.Mtime = time.Now().UnixNano()
+	data, err = encodeInode(*in)
+	if err != nil {
+		return err
+	}
+	return c.commitVersioned(inodePath(ino), data)
+}
+
+// versionedIno returns the inode number of the regular file `path` names, after checking
+// that the client may `op` it with the permission `want`
+func (c *PuddleStoreClient) versionedIno(ctx context.Context, op, path string, want uint32) (uint64, error) {
+	path, err := c.resolve(ctx, path, true)
+	if err != nil {
+		return 0, err
+	}
+	ino, err := lookupIno(ctx, path, c.zkConn)
+	if err != nil {
+		return 0, err
+	}
+	in, _, err := readInode(ctx, ino, c.zkConn)
+	if err != nil {
+		return 0, err
+	}
+	if in.IsDir {
+		return 0, ErrIsDir
+	}
+	if !in.permits(c.ident, want) {
+		return 0, errPermission(op, userPath(path))
+	}
+	return ino, nil
+}
+
+// openVersion opens the previous version `opts.Version` of the file at `path` for
+// reading. The file keeps its read lock until it is closed, since the version would
+// otherwise be pruned by the next commit and its blocks collected while they are read.
+func (c *PuddleStoreClient) openVersion(ctx context.Context, path string, opts OpenOptions) (int, error) {
+	if opts.Create || opts.Write {
+		return -1, ErrPermission
+	}
+	ino, err := c.versionedIno(ctx, "open", path, permRead)
+	if err != nil {
+		return -1, err
+	}
+	dlock := CreateDistLock(inodePath(ino), c.zkConn)
+	if err := dlock.ReadLockContext(ctx); err != nil {
+		return -1, err
+	}
+	data, _, err := c.zkConn.Get(versionPath(ino, opts.Version))
+	if err != nil {
+		dlock.Release()
+		return -1, err
+	}
+	in, err := decodeInode(data)
+	if err != nil {
+		dlock.Release()
+		return -1, err
+	}
+
+	aead, err := c.fileKey(in)
+	if err != nil {
+		dlock.Release()
+		return -1, err
+	}
+	if _, err := c.loadTree(ctx, in); err != nil {
+		dlock.Release()
+		return -1, err
+	}
+
+	fd := c.generateNewFd()
+	c.files[fd] = &File{
+		flags:  O_READ,
+		dlock:  dlock,
+		in:     in,
+		cache:  make(map[string][]byte),
+		frozen: true,
+		aead:   aead,
+		base:   in.Blocks,
+	}
+	return fd, nil
+}
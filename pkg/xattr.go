@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// MaxXattrSize bounds the total size of the names and values of all extended attributes
+// of one inode
+const MaxXattrSize = 64 * 1024
+
+// MaxXattrNameLen bounds the length of an extended attribute name
+const MaxXattrNameLen = 255
+
+func xattrSize(attrs map[string][]byte) int {
+	size := 0
+	for name, value := range attrs {
+		size += len(name) + len(value)
+	}
+	return size
+}
+
+// `SetXattr` sets the extended attribute `name` of `path` to `value`, replacing any
+// previous value. Requires write permission on `path`.
+func (c *PuddleStoreClient) SetXattr(path, name string, value []byte) error {
+	return c.SetXattrContext(context.Background(), path, name, value)
+}
+
+// `SetXattrContext` is `SetXattr` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) SetXattrContext(ctx context.Context, path, name string, value []byte) (err error) {
+	defer func(name string) { err = pathError("setxattr", name, err) }(path)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	if len(name) == 0 || len(name) > MaxXattrNameLen {
+		return fs.ErrInvalid
+	}
+	return c.updateInode(ctx, path, true, func(in *inode) error {
+		if !in.permits(c.ident, permWrite) {
+			return errPermission("setxattr", path)
+		}
+		size := xattrSize(in.Xattrs) + len(name) + len(value)
+		if old, ok := in.Xattrs[name]; ok {
+			size -= len(name) + len(old)
+		}
+		if size > MaxXattrSize {
+			return fmt.Errorf("attributes would exceed %d bytes: %w", MaxXattrSize, fs.ErrInvalid)
+		}
+		if in.Xattrs == nil {
+			in.Xattrs = make(map[string][]byte)
+		}
+		in.Xattrs[name] = append([]byte{}, value...)
+		return nil
+	})
+}
+
+// `GetXattr` returns the value of the extended attribute `name` of `path`. Returns err if
+// the attribute is not set. Requires read permission on `path`.
+func (c *PuddleStoreClient) GetXattr(path, name string) ([]byte, error) {
+	return c.GetXattrContext(context.Background(), path, name)
+}
+
+// `GetXattrContext` is `GetXattr` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) GetXattrContext(ctx context.Context, path, name string) (value []byte, err error) {
+	defer func(name string) { err = pathError("getxattr", name, err) }(path)
+	if c.zkConn == nil {
+		return nil, ErrClientClosed
+	}
+	in, _, err := c.viewInode(ctx, path, true)
+	if err != nil {
+		return nil, err
+	}
+	if !in.permits(c.ident, permRead) {
+		return nil, errPermission("getxattr", path)
+	}
+	value, ok := in.Xattrs[name]
+	if !ok {
+		return nil, fmt.Errorf("attribute %s: %w", name, ErrNotExist)
+	}
+	return value, nil
+}
+
+// `ListXattr` returns the sorted names of all extended attributes of `path`. Requires
+// read permission on `path`.
+func (c *PuddleStoreClient) ListXattr(path string) ([]string, error) {
+	return c.ListXattrContext(context.Background(), path)
+}
+
+// `ListXattrContext` is `ListXattr` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) ListXattrContext(ctx context.Context, path string) (names []string, err error) {
+	defer func(name string) { err = pathError("listxattr", name, err) }(path)
+	if c.zkConn == nil {
+		return nil, ErrClientClosed
+	}
+	in, _, err := c.viewInode(ctx, path, true)
+	if err != nil {
+		return nil, err
+	}
+	if !in.permits(c.ident, permRead) {
+		return nil, errPermission("listxattr", path)
+	}
+	names = make([]string, 0, len(in.Xattrs))
+	for name := range in.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// `RemoveXattr` removes the extended attribute `name` of `path`. Returns err if the
+// attribute is not set. Requires write permission on `path`.
+func (c *PuddleStoreClient) RemoveXattr(path, name string) error {
+	return c.RemoveXattrContext(context.Background(), path, name)
+}
+
+// `RemoveXattrContext` is `RemoveXattr` with a context that bounds lock waits and remote calls.
+func (c *PuddleStoreClient) RemoveXattrContext(ctx context.Context, path, name string) (err error) {
+	defer func(name string) { err = pathError("removexattr", name, err) }(path)
+	if c.zkConn == nil {
+		return ErrClientClosed
+	}
+	return c.updateInode(ctx, path, true, func(in *inode) error {
+		if !in.permits(c.ident, permWrite) {
+			return errPermission("removexattr", path)
+		}
+		if _, ok := in.Xattrs[name]; !ok {
+			return fmt.Errorf("attribute %s: %w", name, ErrNotExist)
+		}
+		delete(in.Xattrs, name)
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestCorruptBlock(t *testing.T) {
+	// content addressed keys let the test find the block it damages
+	config := puddlestore.DefaultConfig()
+	config.ContentAddressed = true
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := bytes.Repeat([]byte("a"), int(config.BlockSize))
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(in)
+	key := "sha256-" + hex.EncodeToString(sum[:])
+
+	// damage every replica, including a truncated one
+	tap := client.(*puddlestore.PuddleStoreClient)
+	for i := 0; i < config.NumTapestry; i++ {
+		err = tap.Store(key, in[:len(in)/2])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = readFile(client, "/a", 0, config.BlockSize)
+	if !errors.Is(err, puddlestore.ErrCorrupt) {
+		t.Fatal("Read Expected corrupt error, got", err)
+	}
+	var corrupt *puddlestore.CorruptError
+	if !errors.As(err, &corrupt) || corrupt.GUID != key {
+		t.Fatalf("Expected: %v, Got: %v", key, err)
+	}
+
+	// one intact replica is enough, and it repairs the damaged ones
+	err = tap.Store(key, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < config.NumTapestry; i++ {
+		out, err := readFile(client, "/a", 0, config.BlockSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, in) {
+			t.Fatalf("Expected: %v, Got: %v", in, out)
+		}
+	}
+
+	client.Exit()
+}
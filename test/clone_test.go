@@ -0,0 +1,111 @@
+package test
+
+import (
+	"errors"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make([]byte, 200)
+	for i := range in {
+		in[i] = byte(i)
+	}
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Clone("/a", "/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := readFile(client, "/b", 0, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	// writing to the clone leaves the source alone
+	err = writeFile(client, "/b", 100, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readFile(client, "/a", 0, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+	out, err = readFile(client, "/b", 100, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "test" {
+		t.Fatalf("Expected: test, Got: %v", string(out))
+	}
+
+	// removing the source keeps the clone readable
+	err = client.Remove("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readFile(client, "/b", 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in[:4]) {
+		t.Fatalf("Expected: %v, Got: %v", in[:4], out)
+	}
+
+	client.Exit()
+}
+
+func TestCloneErrors(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Clone("/missing", "/b")
+	if !errors.Is(err, puddlestore.ErrNotExist) {
+		t.Fatal("Clone Expected not exist error, got", err)
+	}
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Clone("/a", "/a")
+	if !errors.Is(err, puddlestore.ErrExist) {
+		t.Fatal("Clone Expected exist error, got", err)
+	}
+	err = client.Mkdir("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Clone("/dir", "/b")
+	if !errors.Is(err, puddlestore.ErrIsDir) {
+		t.Fatal("Clone Expected is a directory error, got", err)
+	}
+
+	client.Exit()
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"bytes"
+	"math/rand"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	for _, name := range []string{"flate", "gzip"} {
+		config := puddlestore.DefaultConfig()
+		config.Codec = name
+		cluster, err := puddlestore.CreateCluster(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client, err := cluster.NewClient()
+		if err != nil {
+			cluster.Shutdown()
+			t.Fatal(err)
+		}
+
+		// a compressible block followed by one that does not shrink, so the file mixes
+		// encoded and raw blocks
+		in := bytes.Repeat([]byte("a"), int(config.BlockSize))
+		noise := make([]byte, config.BlockSize)
+		rand.New(rand.NewSource(1)).Read(noise)
+		in = append(in, noise...)
+		err = writeFile(client, "/a", 0, in)
+		if err != nil {
+			cluster.Shutdown()
+			t.Fatal(err)
+		}
+		out, err := readFile(client, "/a", 0, uint64(len(in)))
+		if err != nil {
+			cluster.Shutdown()
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, in) {
+			cluster.Shutdown()
+			t.Fatalf("%s Expected: %v, Got: %v", name, in, out)
+		}
+
+		client.Exit()
+		cluster.Shutdown()
+	}
+}
+
+func TestUnknownCodec(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.Codec = "zstd"
+	cluster, err := puddlestore.CreateCluster(config)
+	if err == nil {
+		cluster.Shutdown()
+		t.Fatal("CreateCluster Expected unknown codec error, got", err)
+	}
+}
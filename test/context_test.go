@@ -0,0 +1,94 @@
+package test
+
+import (
+	"context"
+	"errors"
+	puddlestore "puddlestore/pkg"
+	"testing"
+	"time"
+)
+
+func TestContextLockTimeout(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client2, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hold the write lock so the other client has to wait
+	fd, err := client.Open("/a", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = client2.OpenContext(ctx, "/a", false, false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("OpenContext Expected deadline error, got", err)
+	}
+	_, err = client2.StatContext(ctx, "/a")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("StatContext Expected deadline error, got", err)
+	}
+
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the abandoned waits must not be left in the lock queue
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel2()
+	fd, err = client2.OpenContext(ctx2, "/a", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client2.CloseContext(ctx2, fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Exit()
+	client2.Exit()
+}
+
+func TestContextCancelled(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.MkdirContext(ctx, "/dir")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("MkdirContext Expected cancellation error, got", err)
+	}
+	_, err = client.Stat("/dir")
+	if err == nil {
+		t.Fatal("MkdirContext Expected no directory to be created")
+	}
+
+	client.Exit()
+}
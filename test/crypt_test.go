@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.Codec = "flate"
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	key := bytes.Repeat([]byte{7}, 32)
+	client, err := cluster.NewClient(puddlestore.WithMasterKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client2, err := cluster.NewClient(puddlestore.WithMasterKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cluster.NewClient(puddlestore.WithMasterKey(bytes.Repeat([]byte{8}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a file written in the clear gets its key with the first encrypted write
+	err = writeFile(plain, "/a", 0, []byte("clear"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := bytes.Repeat([]byte("secret"), 30)
+	err = writeFile(client, "/a", config.BlockSize, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := readFile(client2, "/a", 0, config.BlockSize+uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out[:5]) != "clear" || !bytes.Equal(out[config.BlockSize:], in) {
+		t.Fatalf("Unexpected content: %v", out)
+	}
+
+	// clients without the master key can neither read nor write it
+	_, err = readFile(plain, "/a", 0, 5)
+	if !errors.Is(err, puddlestore.ErrNoKey) || !errors.Is(err, fs.ErrPermission) {
+		t.Fatal("Read Expected no key error, got", err)
+	}
+	err = writeFile(other, "/a", 0, []byte("test"))
+	if !errors.Is(err, puddlestore.ErrNoKey) {
+		t.Fatal("Write Expected no key error, got", err)
+	}
+
+	// clones share the data key along with the blocks
+	err = client.Clone("/a", "/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readFile(client2, "/b", config.BlockSize, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	client.Exit()
+	client2.Exit()
+	plain.Exit()
+	other.Exit()
+}
+
+func TestEncryptionContentAddressed(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.ContentAddressed = true
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient(puddlestore.WithMasterKey(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// equal blocks are sealed for their own block numbers, and open under their content
+	// keys
+	bs := int(config.BlockSize)
+	in := bytes.Repeat([]byte{'a'}, 3*bs)
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	client.Exit()
+}
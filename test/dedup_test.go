@@ -0,0 +1,92 @@
+package test
+
+import (
+	puddlestore "puddlestore/pkg"
+	"testing"
+	"time"
+)
+
+func TestContentAddressed(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.ContentAddressed = true
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client2, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// four distinct blocks, written by two clients and twice in a row
+	in := make([]byte, 4*config.BlockSize)
+	for i := range in {
+		in[i] = byte(i)
+	}
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client2, "/b", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client2, "/b", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := readFile(client2, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+	out, err = readFile(client, "/b", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	// identical blocks share their key, so only four blocks were ever stored
+	time.Sleep(10 * time.Millisecond)
+	report, err := cluster.CollectGarbage(puddlestore.GCOptions{DryRun: true, Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 4 || report.Live != 4 || len(report.Garbage) != 0 {
+		t.Fatalf("Expected 4 checked and live blocks, Got: %+v", report)
+	}
+
+	// a shared block survives removing one of the files
+	err = client.Remove("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = cluster.CollectGarbage(puddlestore.GCOptions{Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Garbage) != 0 {
+		t.Fatalf("Expected no garbage, Got: %+v", report)
+	}
+	out, err = readFile(client, "/b", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	client.Exit()
+	client2.Exit()
+}
@@ -0,0 +1,178 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestErasureCode(t *testing.T) {
+	// content addressed keys let the test find the block it damages
+	config := puddlestore.DefaultConfig()
+	config.ContentAddressed = true
+	config.NumTapestry = 3
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// five blocks make one full stripe of two and a short last stripe
+	bs := int(config.BlockSize)
+	in := make([]byte, 0, 5*bs)
+	for _, c := range "abcde" {
+		in = append(in, bytes.Repeat([]byte{byte(c)}, bs)...)
+	}
+	code := puddlestore.ErasureCode{Data: 2, Parity: 1}
+	fd, err := client.OpenWith("/a", puddlestore.OpenOptions{Create: true, Write: true, Erasure: &code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Write(fd, 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	// a lost data block is rebuilt from the rest of its stripe
+	sum := sha256.Sum256(in[bs : 2*bs])
+	key := "sha256-" + hex.EncodeToString(sum[:])
+	tap := client.(*puddlestore.PuddleStoreClient)
+	for i := 0; i < config.NumTapestry; i++ {
+		err = tap.Store(key, []byte("lost"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err = readFile(client, "/a", uint64(bs), uint64(bs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in[bs:2*bs]) {
+		t.Fatalf("Expected: %v, Got: %v", in[bs:2*bs], out)
+	}
+
+	// rewriting part of a stripe keeps the parity in step
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(in, "test")
+	out, err = readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	// equal blocks of a stripe share a content key and still read back after a rewrite
+	// of one of them
+	err = writeFile(client, "/a", uint64(2*bs), in[3*bs:4*bs])
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(in[2*bs:], in[3*bs:4*bs])
+	err = writeFile(client, "/a", uint64(3*bs), []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(in[3*bs:], "test")
+	out, err = readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	// invalid codes are rejected
+	_, err = client.OpenWith("/b", puddlestore.OpenOptions{Create: true, Erasure: &puddlestore.ErasureCode{Parity: 1}})
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("OpenWith Expected invalid error, got", err)
+	}
+	// every fragment of a stripe needs a node of its own
+	_, err = client.OpenWith("/b", puddlestore.OpenOptions{Create: true, Erasure: &puddlestore.ErasureCode{Data: 3, Parity: 1}})
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("OpenWith Expected invalid error, got", err)
+	}
+	config.Erasure = puddlestore.ErasureCode{Data: 2, Parity: 2}
+	_, err = puddlestore.CreateCluster(config)
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("CreateCluster Expected invalid error, got", err)
+	}
+
+	client.Exit()
+}
+
+func blockKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256-" + hex.EncodeToString(sum[:])
+}
+
+func TestErasureParityChecksum(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.ContentAddressed = true
+	config.NumTapestry = 4
+	config.Erasure = puddlestore.ErasureCode{Data: 2, Parity: 2}
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs := int(config.BlockSize)
+	in := append(bytes.Repeat([]byte{'a'}, bs), bytes.Repeat([]byte{'b'}, bs)...)
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a damaged parity fragment is skipped when the lost block is rebuilt from the other
+	sum := sha256.Sum256([]byte(blockKey(in[:bs]) + "\n" + blockKey(in[bs:]) + "\n0"))
+	parity := "parity-" + hex.EncodeToString(sum[:])
+	tap := client.(*puddlestore.PuddleStoreClient)
+	for i := 0; i < config.NumTapestry; i++ {
+		err = tap.Store(parity, []byte("damaged parity"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tap.Store(blockKey(in[bs:]), []byte("lost"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	client.Exit()
+}
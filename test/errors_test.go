@@ -0,0 +1,109 @@
+package test
+
+import (
+	"errors"
+	"io/fs"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestErrorsIs(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Open("/missing", false, false)
+	if !errors.Is(err, puddlestore.ErrNotExist) || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("Open Expected not exist error, got", err)
+	}
+	var pe *fs.PathError
+	if !errors.As(err, &pe) || pe.Op != "open" || pe.Path != "/missing" {
+		t.Fatal("Open Expected path error on /missing, got", err)
+	}
+	_, err = client.Stat("/missing")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("Stat Expected not exist error, got", err)
+	}
+	err = client.Remove("/missing")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("Remove Expected not exist error, got", err)
+	}
+
+	err = client.Mkdir("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Mkdir("/dir")
+	if !errors.Is(err, puddlestore.ErrExist) {
+		t.Fatal("Mkdir Expected exist error, got", err)
+	}
+	_, err = client.Open("/dir", false, false)
+	if !errors.Is(err, puddlestore.ErrIsDir) {
+		t.Fatal("Open Expected is a directory error, got", err)
+	}
+
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Open("/a/b", true, true)
+	if !errors.Is(err, puddlestore.ErrNotDir) {
+		t.Fatal("Open Expected not a directory error, got", err)
+	}
+	err = client.Rename("/dir", "/a")
+	if !errors.Is(err, fs.ErrExist) {
+		t.Fatal("Rename Expected exist error, got", err)
+	}
+
+	err = client.Close(42)
+	if !errors.Is(err, puddlestore.ErrBadFd) {
+		t.Fatal("Close Expected bad file descriptor error, got", err)
+	}
+	fd, err := client.Open("/a", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Write(fd, 0, []byte("x"))
+	if !errors.Is(err, puddlestore.ErrBadFd) {
+		t.Fatal("Write Expected bad file descriptor error, got", err)
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// empty paths are invalid, not a crash
+	err = client.Mkdir("")
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("Mkdir Expected invalid error, got", err)
+	}
+	err = client.Rename("", "/b")
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("Rename Expected invalid error, got", err)
+	}
+	err = client.Link("/a", "")
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("Link Expected invalid error, got", err)
+	}
+	err = client.Clone("/a", "")
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("Clone Expected invalid error, got", err)
+	}
+	err = client.Symlink("/a", "")
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("Symlink Expected invalid error, got", err)
+	}
+
+	client.Exit()
+	_, err = client.Open("/a", false, false)
+	if !errors.Is(err, puddlestore.ErrClientClosed) || !errors.Is(err, fs.ErrClosed) {
+		t.Fatal("Open Expected client closed error, got", err)
+	}
+}
@@ -0,0 +1,173 @@
+package test
+
+import (
+	"io"
+	"io/fs"
+	puddlestore "puddlestore/pkg"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSConformance(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.MkdirAll("/dir/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/a", 0, []byte("abcdefghijklmnopqrstuvwxyz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/dir/b", 0, make([]byte, 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/dir/sub/c", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := puddlestore.NewFS(client)
+	if err := fstest.TestFS(fsys, "a", "dir/b", "dir/sub/c"); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := fs.Sub(fsys, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(sub, "b", "sub/c"); err != nil {
+		t.Fatal(err)
+	}
+	client.Exit()
+}
+
+func TestFSWalkDir(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.MkdirAll("/x/y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/x/y/z", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a link back to an ancestor would make the walk loop if it were followed
+	err = client.Symlink("/x", "/x/y/up")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var visited []string
+	err = fs.WalkDir(puddlestore.NewFS(client), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		visited = append(visited, path)
+		if path == "x/y/up" && d.Type() != fs.ModeSymlink {
+			t.Fatalf("Expected: %v, Got: %v", fs.ModeSymlink, d.Type())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) != 5 || visited[3] != "x/y/up" || visited[4] != "x/y/z" {
+		t.Fatalf("Expected: [. x x/y x/y/up x/y/z], Got: %v", visited)
+	}
+
+	f, err := puddlestore.NewFS(client).Open("x/y/z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(io.Writer); ok {
+		t.Fatal("Open Expected a read-only file")
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if string(data) != "test" {
+		t.Fatalf("Expected: test, Got: %v", string(data))
+	}
+	client.Exit()
+}
+
+func TestFSConcurrent(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := make([]byte, 300)
+	for i := range in {
+		in[i] = byte(i)
+	}
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// servers like http.FileServerFS open files from many goroutines at once
+	fsys := puddlestore.NewFS(client)
+	var wg sync.WaitGroup
+	wg.Add(8)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				var out []byte
+				var err error
+				if i%2 == 0 {
+					out, err = fs.ReadFile(fsys, "a")
+				} else {
+					var f fs.File
+					f, err = fsys.Open("a")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					out, err = io.ReadAll(f)
+					f.Close()
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if string(out) != string(in) {
+					t.Errorf("Expected: %v, Got: %v", in, out)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	client.Exit()
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	puddlestore "puddlestore/pkg"
+	"testing"
+	"time"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.MaxVersions = 0
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make([]byte, 200)
+	for i := range in {
+		in[i] = byte(i)
+	}
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/b", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// overwriting replaces the first block of /a, removing drops all blocks of /b
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Remove("/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// young journal entries are left alone
+	report, err := cluster.CollectGarbage(puddlestore.GCOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Garbage) != 0 || report.Pending == 0 {
+		t.Fatalf("Expected only pending blocks, Got: %+v", report)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	report, err = cluster.CollectGarbage(puddlestore.GCOptions{DryRun: true, Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Garbage) != 5 || report.Live != 4 {
+		t.Fatalf("Expected 5 garbage and 4 live blocks, Got: %+v", report)
+	}
+	report, err = cluster.CollectGarbage(puddlestore.GCOptions{Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Garbage) != 5 {
+		t.Fatalf("Expected 5 garbage blocks, Got: %+v", report)
+	}
+
+	out, err := readFile(client, "/a", 0, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out[:4]) != "test" || string(out[4:]) != string(in[4:]) {
+		t.Fatalf("Unexpected content after collection: %v", out)
+	}
+
+	// live blocks stay in the journal until they die
+	report, err = cluster.CollectGarbage(puddlestore.GCOptions{Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Garbage) != 0 || report.Checked != 4 {
+		t.Fatalf("Expected 4 checked live blocks, Got: %+v", report)
+	}
+
+	client.Exit()
+}
+
+func TestCollectGarbageCloneRestore(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.MaxVersions = 1
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make([]byte, 200)
+	for i := range in {
+		in[i] = byte(i)
+	}
+	other := make([]byte, 200)
+	for i := range other {
+		other[i] = byte(255 - i)
+	}
+
+	// the clone keeps the blocks the source drops
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Clone("/a", "/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/a", 0, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, err = cluster.CollectGarbage(puddlestore.GCOptions{Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := readFile(client, "/c", 0, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	// the restored content moves from the history back into the file, and into the
+	// history again once it is overwritten
+	err = writeFile(client, "/b", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/b", 0, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := client.ListVersions("/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Restore("/b", versions[0].Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, err = cluster.CollectGarbage(puddlestore.GCOptions{Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readFile(client, "/b", 0, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	err = writeFile(client, "/b", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, err = cluster.CollectGarbage(puddlestore.GCOptions{Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err = client.ListVersions("/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readVersion(client, "/b", versions[0].Version, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	client.Exit()
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestFileHandleCopy(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz"), 20)
+	w, err := client.OpenFile("/a", puddlestore.OpenOptions{Create: true, Write: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(w, bytes.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(in)) {
+		t.Fatalf("Expected: %v bytes copied, Got: %v", len(in), n)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := client.OpenFile("/a", puddlestore.OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("Expected: %v, Got: %v", string(in), string(out))
+	}
+
+	pos, err := r.Seek(-26, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != int64(len(in)-26) {
+		t.Fatalf("Expected: position %v, Got: %v", len(in)-26, pos)
+	}
+	buf := make([]byte, 26)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "abcdefghijklmnopqrstuvwxyz" {
+		t.Fatalf("Expected: alphabet, Got: %v", string(buf))
+	}
+
+	_, err = r.ReadAt(buf, int64(len(in)-10))
+	if err != io.EOF {
+		t.Fatalf("Expected: io.EOF from a short ReadAt, Got: %v", err)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Exit()
+}
+
+func TestFileHandleJSON(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := map[string]int{"a": 1, "b": 2}
+	w, err := client.OpenFile("/a.json", puddlestore.OpenOptions{Create: true, Write: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.NewEncoder(w).Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := client.OpenFile("/a.json", puddlestore.OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]int
+	err = json.NewDecoder(r).Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["a"] != 1 || out["b"] != 2 {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+	r.Close()
+	client.Exit()
+}
+
+func TestFileHandleClosed(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := client.OpenFile("/a", puddlestore.OpenOptions{Create: true, Write: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the descriptor of the closed handle is handed out again, so using the handle must
+	// not touch the file that got it
+	fd, err := client.Open("/b", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Close()
+	if !errors.Is(err, fs.ErrClosed) {
+		t.Fatal("Close Expected closed error, got", err)
+	}
+	_, err = h.Write([]byte("test"))
+	if !errors.Is(err, fs.ErrClosed) {
+		t.Fatal("Write Expected closed error, got", err)
+	}
+	_, err = h.Read(make([]byte, 4))
+	if !errors.Is(err, fs.ErrClosed) {
+		t.Fatal("Read Expected closed error, got", err)
+	}
+	_, err = h.Seek(0, io.SeekEnd)
+	if !errors.Is(err, fs.ErrClosed) {
+		t.Fatal("Seek Expected closed error, got", err)
+	}
+	err = client.Write(fd, 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Exit()
+}
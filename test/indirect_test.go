@@ -0,0 +1,172 @@
+package test
+
+import (
+	"bytes"
+	puddlestore "puddlestore/pkg"
+	"testing"
+	"time"
+)
+
+func TestIndirectBlocks(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.MaxVersions = 0
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 12 direct blocks and the rest behind a two-level tree: a root listing two pointer
+	// blocks
+	blocks := 1100
+	in := make([]byte, blocks*int(config.BlockSize))
+	for i := range in {
+		in[i] = byte(i / int(config.BlockSize))
+	}
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(in)) || info.Blocks() != blocks {
+		t.Fatalf("Expected: %v bytes in %v blocks, Got: %v bytes in %v blocks", len(in), blocks, info.Size(), info.Blocks())
+	}
+	out, err := readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatal("Unexpected content after write")
+	}
+
+	// changing a block behind the second pointer block only replaces it and the root
+	offset := 1050 * config.BlockSize
+	err = writeFile(client, "/a", offset, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(in[offset:], "test")
+	out, err = readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatal("Unexpected content after overwrite")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	report, err := cluster.CollectGarbage(puddlestore.GCOptions{DryRun: true, Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Live != blocks+3 || len(report.Garbage) != 3 {
+		t.Fatalf("Expected %v live and 3 garbage blocks, Got: %+v", blocks+3, report)
+	}
+
+	// shrinking back into the direct blocks drops the pointer blocks
+	err = client.Truncate("/a", 4*config.BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in[:4*config.BlockSize]) {
+		t.Fatal("Unexpected content after truncate")
+	}
+
+	client.Exit()
+}
+
+func TestIndirectCloneRestore(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.MaxVersions = 1
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zkConn, err := puddlestore.ConnectZk(config.ZkAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zkConn.Close()
+
+	blocks := 2000
+	in := make([]byte, blocks*int(config.BlockSize))
+	for i := range in {
+		in[i] = byte(i / int(config.BlockSize))
+	}
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Clone("/a", "/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := client.ListVersions("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Restore("/a", versions[0].Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// clones and restored files share the pointer blocks instead of listing every block
+	inodes, _, err := zkConn.Children(puddlestore.INODES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range inodes {
+		data, _, err := zkConn.Get(puddlestore.INODES + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 4096 {
+			t.Fatalf("Expected an inode of at most 4096 bytes, Got: %v bytes", len(data))
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	_, err = cluster.CollectGarbage(puddlestore.GCOptions{Grace: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatal("Unexpected content after restore")
+	}
+	copy(in, "test")
+	out, err = readFile(client, "/b", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatal("Unexpected content of the clone")
+	}
+
+	client.Exit()
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestLinkSharesData(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Mkdir("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Link("/a", "/d/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a write through one name is visible through the other
+	err = writeFile(client, "/d/b", 0, []byte("TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := readFile(client, "/a", 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "TEST" {
+		t.Fatalf("Expected: TEST, Got: %v", string(out))
+	}
+
+	info, err := client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Links() != 2 {
+		t.Fatalf("Expected: 2 links, Got: %v", info.Links())
+	}
+
+	names, err := client.List("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "b" {
+		t.Fatalf("Expected: [b], Got: %v", names)
+	}
+
+	// removing one name keeps the file alive under the other
+	err = client.Remove("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readFile(client, "/d/b", 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "TEST" {
+		t.Fatalf("Expected: TEST, Got: %v", string(out))
+	}
+	info, err = client.Stat("/d/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Links() != 1 {
+		t.Fatalf("Expected: 1 link, Got: %v", info.Links())
+	}
+
+	err = client.Remove("/d/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Stat("/d/b")
+	if err == nil {
+		t.Fatal("LinkSharesData Expected error after removing the last name")
+	}
+	client.Exit()
+}
+
+func TestLinkInvalid(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Link("/a", "/b")
+	if err == nil {
+		t.Fatal("LinkInvalid Expected error for missing source")
+	}
+
+	err = client.Mkdir("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Link("/d", "/e")
+	if err == nil {
+		t.Fatal("LinkInvalid Expected error when linking a directory")
+	}
+
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Link("/a", "/d")
+	if err == nil {
+		t.Fatal("LinkInvalid Expected error for existing target")
+	}
+	client.Exit()
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	puddlestore "puddlestore/pkg"
+	"sync"
+	"testing"
+)
+
+func TestMkdirAll(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.MkdirAll("/a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := client.List("/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "c" {
+		t.Fatalf("Expected: [c], Got: %v", names)
+	}
+
+	// existing directories are not an error
+	err = client.MkdirAll("/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFile(client, "/a/f", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.MkdirAll("/a/f/g")
+	if err == nil {
+		t.Fatal("MkdirAll Expected error when an ancestor is a file")
+	}
+	client.Exit()
+}
+
+func TestMkdirAllConcurrent(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		client, err := cluster.NewClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(client puddlestore.Client) {
+			defer wg.Done()
+			errs <- client.MkdirAll("/x/y/z")
+		}(client)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpenCreateParents(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Open("/a/b/c", true, true)
+	if err == nil {
+		t.Fatal("OpenCreateParents Expected error without CreateParents")
+	}
+
+	fd, err := client.OpenWith("/a/b/c", puddlestore.OpenOptions{Create: true, Write: true, CreateParents: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Write(fd, 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := readFile(client, "/a/b/c", 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "test" {
+		t.Fatalf("Expected: test, Got: %v", string(out))
+	}
+	client.Exit()
+}
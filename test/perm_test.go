@@ -0,0 +1,95 @@
+package test
+
+import (
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestPermissionOwnerGroupOther(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	root, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := cluster.NewClient(puddlestore.WithIdentity(puddlestore.Identity{Uid: 1000, Gid: 100}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := cluster.NewClient(puddlestore.WithIdentity(puddlestore.Identity{Uid: 1001, Gid: 200, Groups: []uint32{100}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cluster.NewClient(puddlestore.WithIdentity(puddlestore.Identity{Uid: 2000, Gid: 200}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = root.Mkdir("/team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = root.Chown("/team", 1000, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = owner.Chmod("/team", 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFile(owner, "/team/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := owner.Stat("/team/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// files inherit the group and the non-execute bits of their directory
+	if info.Uid() != 1000 || info.Gid() != 100 || info.Mode().Perm() != 0640 {
+		t.Fatalf("Unexpected owner %v:%v mode %v", info.Uid(), info.Gid(), info.Mode())
+	}
+
+	out, err := readFile(member, "/team/a", 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "test" {
+		t.Fatalf("Expected: test, Got: %v", string(out))
+	}
+	_, err = member.Open("/team/a", false, true)
+	if err == nil {
+		t.Fatal("PermissionOwnerGroupOther Expected error when a group member writes")
+	}
+	err = member.Remove("/team/a")
+	if err == nil {
+		t.Fatal("PermissionOwnerGroupOther Expected error when a group member removes")
+	}
+
+	_, err = other.List("/team")
+	if err == nil {
+		t.Fatal("PermissionOwnerGroupOther Expected error when others list")
+	}
+	_, err = other.Open("/team/a", false, false)
+	if err == nil {
+		t.Fatal("PermissionOwnerGroupOther Expected error when others traverse")
+	}
+	err = other.Chmod("/team", 0777)
+	if err == nil {
+		t.Fatal("PermissionOwnerGroupOther Expected error when others chmod")
+	}
+	err = owner.Chown("/team", 2000, 100)
+	if err == nil {
+		t.Fatal("PermissionOwnerGroupOther Expected error when the owner gives a file away")
+	}
+
+	root.Exit()
+	owner.Exit()
+	member.Exit()
+	other.Exit()
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestRenameFile(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := "abcdefghijklmnopqrstuvwxyz"
+	err = writeFile(client, "/a", 0, []byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Rename("/a", "/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Open("/a", false, false)
+	if err == nil {
+		t.Fatal("RenameFile Expected error when opening old path")
+	}
+
+	out, err := readFile(client, "/b", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Fatalf("Expected: %v, Got: %v", in, string(out))
+	}
+	client.Exit()
+}
+
+func TestRenameDirectory(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Mkdir("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Mkdir("/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "test"
+	err = writeFile(client, "/a/b/c", 0, []byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Mkdir("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Rename("/a", "/d/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := client.List("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "d" {
+		t.Fatalf("Expected: [d], Got: %v", names)
+	}
+
+	out, err := readFile(client, "/d/a/b/c", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Fatalf("Expected: %v, Got: %v", in, string(out))
+	}
+
+	// the moved file must still be lockable for writing
+	err = writeFile(client, "/d/a/b/c", 0, []byte("TEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Exit()
+}
+
+func TestRenameInvalid(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Rename("/a", "/b")
+	if err == nil {
+		t.Fatal("RenameInvalid Expected error for missing source")
+	}
+
+	err = client.Mkdir("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/b", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Rename("/a", "/b")
+	if err == nil {
+		t.Fatal("RenameInvalid Expected error for existing target")
+	}
+	err = client.Rename("/a", "/a/c")
+	if err == nil {
+		t.Fatal("RenameInvalid Expected error when moving a directory into itself")
+	}
+	err = client.Rename("/a", "/x/y")
+	if err == nil {
+		t.Fatal("RenameInvalid Expected error for missing target parent")
+	}
+	client.Exit()
+}
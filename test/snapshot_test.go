@@ -0,0 +1,226 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func readSnapshot(client puddlestore.Client, snapshot, path string, offset, size uint64) ([]byte, error) {
+	fd, err := client.OpenWith(path, puddlestore.OpenOptions{Snapshot: snapshot})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close(fd)
+	return client.Read(fd, offset, size)
+}
+
+func TestSnapshot(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.MkdirAll("/data/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/data/a", 0, []byte("old a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/data/sub/b", 0, []byte("old b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Snapshot("/data", "nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// change the live tree
+	err = writeFile(client, "/data/a", 0, []byte("new a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Remove("/data/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := readSnapshot(client, "nightly", "/a", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "old a" {
+		t.Fatalf("Expected: old a, Got: %v", string(out))
+	}
+	out, err = readSnapshot(client, "nightly", "/sub/b", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "old b" {
+		t.Fatalf("Expected: old b, Got: %v", string(out))
+	}
+	out, err = readFile(client, "/data/a", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "new a" {
+		t.Fatalf("Expected: new a, Got: %v", string(out))
+	}
+
+	// snapshots are read-only
+	_, err = client.OpenWith("/a", puddlestore.OpenOptions{Snapshot: "nightly", Write: true})
+	if !errors.Is(err, puddlestore.ErrPermission) {
+		t.Fatal("OpenWith Expected permission error, got", err)
+	}
+	_, err = readSnapshot(client, "nightly", "/missing", 0, 5)
+	if !errors.Is(err, puddlestore.ErrNotExist) {
+		t.Fatal("OpenWith Expected not exist error, got", err)
+	}
+
+	client.Exit()
+}
+
+func TestListDeleteSnapshot(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Mkdir("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/data/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Snapshot("/data", "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Snapshot("/data", "s2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Snapshot("/data", "s1")
+	if !errors.Is(err, puddlestore.ErrExist) {
+		t.Fatal("Snapshot Expected exist error, got", err)
+	}
+	err = client.Snapshot("/data/a", "s3")
+	if !errors.Is(err, puddlestore.ErrNotDir) {
+		t.Fatal("Snapshot Expected not a directory error, got", err)
+	}
+
+	infos, err := client.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Name != "s1" || infos[1].Name != "s2" || infos[0].Dir != "/data" {
+		t.Fatalf("Unexpected snapshots %v", infos)
+	}
+
+	err = client.DeleteSnapshot("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.DeleteSnapshot("s1")
+	if !errors.Is(err, puddlestore.ErrNotExist) {
+		t.Fatal("DeleteSnapshot Expected not exist error, got", err)
+	}
+	infos, err = client.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name != "s2" {
+		t.Fatalf("Unexpected snapshots %v", infos)
+	}
+
+	client.Exit()
+}
+
+func TestLargeSnapshot(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the frozen inodes take more than the 1 MB a zookeeper transaction may hold
+	err = client.Mkdir("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := make([]byte, 60*1024)
+	for i := 0; i < 24; i++ {
+		path := fmt.Sprintf("/data/f%d", i)
+		err = writeFile(client, path, 0, []byte(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.SetXattr(path, "user.pad", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = client.Snapshot("/data", "large")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := client.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name != "large" {
+		t.Fatalf("Unexpected snapshots %v", infos)
+	}
+	for i := 0; i < 24; i++ {
+		path := fmt.Sprintf("/data/f%d", i)
+		out, err := readSnapshot(client, "large", fmt.Sprintf("/f%d", i), 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != path {
+			t.Fatalf("Expected: %v, Got: %v", path, string(out))
+		}
+	}
+
+	err = client.DeleteSnapshot("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err = client.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Fatalf("Unexpected snapshots %v", infos)
+	}
+	_, err = readSnapshot(client, "large", "/f0", 0, 10)
+	if !errors.Is(err, puddlestore.ErrNotExist) {
+		t.Fatal("OpenWith Expected not exist error, got", err)
+	}
+
+	client.Exit()
+}
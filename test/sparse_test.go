@@ -0,0 +1,264 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestSparseFile(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writing far past the end only allocates the written block
+	offset := 100 * config.BlockSize
+	err = writeFile(client, "/a", offset, []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(offset+1) {
+		t.Fatalf("Expected: %v, Got: %v", offset+1, info.Size())
+	}
+	if info.Blocks() != 1 {
+		t.Fatalf("Expected: %v, Got: %v", 1, info.Blocks())
+	}
+	out, err := readFile(client, "/a", 0, offset+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(make([]byte, offset), 'x')
+	if !bytes.Equal(out, expected) {
+		t.Fatalf("Expected: %v, Got: %v", expected, out)
+	}
+
+	// growing by truncation does not allocate either
+	err = client.Truncate("/a", 2*offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Blocks() != 1 {
+		t.Fatalf("Expected: %v, Got: %v", 1, info.Blocks())
+	}
+
+	// writing into a hole fills it
+	err = writeFile(client, "/a", 5, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readFile(client, "/a", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, []byte("\x00\x00\x00\x00\x00test\x00")) {
+		t.Fatalf("Expected: %v, Got: %v", "\x00\x00\x00\x00\x00test\x00", out)
+	}
+
+	client.Exit()
+}
+
+func TestPunchHole(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := 4 * config.BlockSize
+	in := make([]byte, size)
+	for i := range in {
+		in[i] = byte(i + 1)
+	}
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the range starts and ends inside blocks and covers one block entirely
+	start := config.BlockSize / 2
+	length := 2 * config.BlockSize
+	fd, err := client.Open("/a", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.PunchHole(fd, start, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(size) {
+		t.Fatalf("Expected: %v, Got: %v", size, info.Size())
+	}
+	if info.Blocks() != 3 {
+		t.Fatalf("Expected: %v, Got: %v", 3, info.Blocks())
+	}
+	for i := start; i < start+length; i++ {
+		in[i] = 0
+	}
+	out, err := readFile(client, "/a", 0, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("Expected: %v, Got: %v", in, out)
+	}
+
+	// punching a read-only file fails
+	fd, err = client.Open("/a", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.PunchHole(fd, 0, size)
+	if err == nil {
+		t.Fatal("PunchHole Expected error, got", err)
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Exit()
+}
+
+func TestLargeSparseFile(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the holes before a block 1 GB into the file cost nothing, even at the default
+	// block size
+	offset := uint64(1 << 30)
+	err = writeFile(client, "/a", offset, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/a", 5, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(offset+4) || info.Blocks() != 2 {
+		t.Fatalf("Expected: %v bytes in 2 blocks, Got: %v bytes in %v blocks", offset+4, info.Size(), info.Blocks())
+	}
+	out, err := readFile(client, "/a", offset-2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, []byte("\x00\x00test")) {
+		t.Fatalf("Expected: %v, Got: %v", "\x00\x00test", out)
+	}
+	out, err = readFile(client, "/a", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, []byte("\x00\x00\x00\x00\x00test\x00")) {
+		t.Fatalf("Expected: %v, Got: %v", "\x00\x00\x00\x00\x00test\x00", out)
+	}
+
+	// punching the far block leaves holes only behind the direct blocks
+	fd, err := client.Open("/a", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.PunchHole(fd, offset, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(offset+4) || info.Blocks() != 1 {
+		t.Fatalf("Expected: %v bytes in 1 block, Got: %v bytes in %v blocks", offset+4, info.Size(), info.Blocks())
+	}
+	out, err = readFile(client, "/a", offset, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, make([]byte, 4)) {
+		t.Fatalf("Expected: %v, Got: %v", make([]byte, 4), out)
+	}
+
+	client.Exit()
+}
+
+func TestMaxOffset(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a file may end at the largest uint64 offset
+	offset := uint64(math.MaxUint64 - 4)
+	err = writeFile(client, "/a", offset, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := readFile(client, "/a", offset-2, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, []byte("\x00\x00test")) {
+		t.Fatalf("Expected: %v, Got: %v", "\x00\x00test", out)
+	}
+
+	// but not past it
+	err = writeFile(client, "/a", offset+1, []byte("test"))
+	if !errors.Is(err, puddlestore.ErrFileTooLarge) {
+		t.Fatal("Write Expected file too large error, got", err)
+	}
+
+	client.Exit()
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"io/fs"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestStatFile(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := make([]byte, 100)
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "a" || info.IsDir() || info.Size() != 100 {
+		t.Fatalf("Unexpected stat: name %v, dir %v, size %v", info.Name(), info.IsDir(), info.Size())
+	}
+	// 100 bytes span two 64-byte blocks
+	if info.Blocks() != 2 {
+		t.Fatalf("Expected: 2 blocks, Got: %v", info.Blocks())
+	}
+
+	version := info.Version()
+	err = writeFile(client, "/a", 100, []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 101 || info.Version() <= version {
+		t.Fatalf("Expected size 101 and newer version, Got: %v, %v", info.Size(), info.Version())
+	}
+	client.Exit()
+}
+
+func TestStatDirectory(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Mkdir("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info fs.FileInfo
+	info, err = client.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || !info.Mode().IsDir() {
+		t.Fatal("StatDirectory Expected a directory")
+	}
+
+	_, err = client.Stat("/b")
+	if err == nil {
+		t.Fatal("StatDirectory Expected error for missing path")
+	}
+	client.Exit()
+}
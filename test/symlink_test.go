@@ -0,0 +1,122 @@
+package test
+
+import (
+	"errors"
+	"io/fs"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestSymlinkDirectory(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.MkdirAll("/data/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "test"
+	err = writeFile(client, "/data/v1/a", 0, []byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Symlink("v1", "/data/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := client.Readlink("/data/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "v1" {
+		t.Fatalf("Expected: v1, Got: %v", target)
+	}
+
+	out, err := readFile(client, "/data/latest/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Fatalf("Expected: %v, Got: %v", in, string(out))
+	}
+
+	names, err := client.List("/data/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "a" {
+		t.Fatalf("Expected: [a], Got: %v", names)
+	}
+
+	info, err := client.Lstat("/data/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		t.Fatal("SymlinkDirectory Expected Lstat to describe the link")
+	}
+	info, err = client.Stat("/data/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() {
+		t.Fatal("SymlinkDirectory Expected Stat to follow the link")
+	}
+
+	// removing the link leaves the target alone
+	err = client.Remove("/data/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = readFile(client, "/data/v1/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Exit()
+}
+
+func TestSymlinkLoop(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Symlink("/b", "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Symlink("/a", "/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Open("/a", false, false)
+	if !errors.Is(err, puddlestore.ErrLoop) {
+		t.Fatal("SymlinkLoop Expected loop error, got", err)
+	}
+	_, err = client.List("/a")
+	if !errors.Is(err, puddlestore.ErrLoop) {
+		t.Fatal("SymlinkLoop Expected loop error, got", err)
+	}
+
+	_, err = client.Readlink("/c")
+	if err == nil {
+		t.Fatal("SymlinkLoop Expected error for missing link")
+	}
+	client.Exit()
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	puddlestore "puddlestore/pkg"
+	"testing"
+	"time"
+)
+
+func TestTimestampsOnWrite(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	err = client.Mkdir("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeFile(client, "/d/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := client.Stat("/d/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CreateTime().Before(before) || info.ModTime().Before(info.CreateTime()) {
+		t.Fatalf("Unexpected times: created %v, modified %v", info.CreateTime(), info.ModTime())
+	}
+	created, modified := info.CreateTime(), info.ModTime()
+
+	dir, err := client.Stat("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.ModTime().Before(created) {
+		t.Fatal("TimestampsOnWrite Expected creating a file to update the directory mtime")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	err = writeFile(client, "/d/a", 4, []byte("more"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = client.Stat("/d/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.CreateTime().Equal(created) || !info.ModTime().After(modified) {
+		t.Fatalf("Unexpected times: created %v, modified %v", info.CreateTime(), info.ModTime())
+	}
+
+	// reading a file modified after its last access updates the access time
+	_, err = readFile(client, "/d/a", 0, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = client.Stat("/d/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.AccessTime().Before(info.ModTime()) {
+		t.Fatal("TimestampsOnWrite Expected the access time to be updated")
+	}
+
+	modified = dir.ModTime()
+	time.Sleep(10 * time.Millisecond)
+	err = client.Remove("/d/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err = client.Stat("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dir.ModTime().After(modified) {
+		t.Fatal("TimestampsOnWrite Expected removing a file to update the directory mtime")
+	}
+	client.Exit()
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"bytes"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestTruncateShrink(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz"), 10)
+	err = writeFile(client, "/a", 0, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Truncate("/a", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := readFile(client, "/a", 0, uint64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in[:100]) {
+		t.Fatalf("Expected: %v, Got: %v", string(in[:100]), string(out))
+	}
+
+	// growing again must expose zeros rather than the truncated data
+	err = client.Truncate("/a", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readFile(client, "/a", 100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, make([]byte, 100)) {
+		t.Fatalf("Expected zeros, Got: %v", out)
+	}
+	client.Exit()
+}
+
+func TestFtruncate(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fd, err := client.Open("/a", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Ftruncate(fd, 10)
+	if err == nil {
+		t.Fatal("Ftruncate Expected error on read-only fd")
+	}
+	client.Close(fd)
+
+	fd, err = client.Open("/a", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Write(fd, 0, []byte("abcdefghij"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Ftruncate(fd, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := client.Read(fd, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "abc" {
+		t.Fatalf("Expected: abc, Got: %v", string(out))
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Ftruncate(fd, 0)
+	if err == nil {
+		t.Fatal("Ftruncate Expected error on closed fd")
+	}
+	client.Exit()
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"errors"
+	puddlestore "puddlestore/pkg"
+	"testing"
+	"time"
+)
+
+func TestNonBlockingOpen(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client2, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// readers share the lock
+	fd, err := client.Open("/a", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd2, err := client2.OpenWith("/a", puddlestore.OpenOptions{NonBlocking: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client2.Close(fd2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client2.OpenWith("/a", puddlestore.OpenOptions{Write: true, NonBlocking: true})
+	if !errors.Is(err, puddlestore.ErrLocked) {
+		t.Fatal("OpenWith Expected locked error, got", err)
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed attempt must not be left in the lock queue
+	fd2, err = client2.OpenWith("/a", puddlestore.OpenOptions{Write: true, NonBlocking: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.OpenWith("/a", puddlestore.OpenOptions{NonBlocking: true})
+	if !errors.Is(err, puddlestore.ErrLocked) {
+		t.Fatal("OpenWith Expected locked error, got", err)
+	}
+	err = client2.Close(fd2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Exit()
+	client2.Exit()
+}
+
+func TestLockTimeout(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	zkConn, err := puddlestore.ConnectZk(puddlestore.DefaultConfig().ZkAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zkConn.Close()
+
+	lock := puddlestore.CreateDistLock(puddlestore.JOURNAL, zkConn)
+	lock2 := puddlestore.CreateDistLock(puddlestore.JOURNAL, zkConn)
+
+	err = lock.WriteLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lock2.ReadLockTimeout(100 * time.Millisecond)
+	if !errors.Is(err, puddlestore.ErrLocked) {
+		t.Fatal("ReadLockTimeout Expected locked error, got", err)
+	}
+	err = lock2.WriteLockTimeout(100 * time.Millisecond)
+	if !errors.Is(err, puddlestore.ErrLocked) {
+		t.Fatal("WriteLockTimeout Expected locked error, got", err)
+	}
+	err = lock.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the timed out waits must not be left in the lock queue
+	err = lock2.ReadLockTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lock.ReadLockTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lock.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lock.WriteLockTimeout(100 * time.Millisecond)
+	if !errors.Is(err, puddlestore.ErrLocked) {
+		t.Fatal("WriteLockTimeout Expected locked error, got", err)
+	}
+	err = lock2.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lock.WriteLockTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lock.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
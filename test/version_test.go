@@ -0,0 +1,171 @@
+package test
+
+import (
+	"errors"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func readVersion(client puddlestore.Client, path string, version int, size uint64) ([]byte, error) {
+	fd, err := client.OpenWith(path, puddlestore.OpenOptions{Version: version})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close(fd)
+	return client.Read(fd, 0, size)
+}
+
+func TestVersions(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.MaxVersions = 8
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{"one", "two", "three"} {
+		err = writeFile(client, "/a", 0, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every commit that changed the file keeps the content it replaced
+	versions, err := client.ListVersions("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("Expected 2 versions, Got: %v", versions)
+	}
+	last := versions[1]
+	if last.Size != 3 {
+		t.Fatalf("Expected size 3, Got: %v", last)
+	}
+	out, err := readVersion(client, "/a", last.Version, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "two" {
+		t.Fatalf("Expected: two, Got: %v", string(out))
+	}
+
+	err = client.Restore("/a", last.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readFile(client, "/a", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "two" {
+		t.Fatalf("Expected: two, Got: %v", string(out))
+	}
+
+	// the restored content can be restored again
+	versions, err = client.ListVersions("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = readVersion(client, "/a", versions[len(versions)-1].Version, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "three" {
+		t.Fatalf("Expected: three, Got: %v", string(out))
+	}
+
+	_, err = client.OpenWith("/a", puddlestore.OpenOptions{Version: 1000})
+	if !errors.Is(err, puddlestore.ErrNotExist) {
+		t.Fatal("OpenWith Expected not exist error, got", err)
+	}
+
+	// an open version keeps writers from committing and pruning it
+	fd, err := client.OpenWith("/a", puddlestore.OpenOptions{Version: versions[0].Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.OpenWith("/a", puddlestore.OpenOptions{Write: true, NonBlocking: true})
+	if !errors.Is(err, puddlestore.ErrLocked) {
+		t.Fatal("OpenWith Expected locked error, got", err)
+	}
+	err = client.Close(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Exit()
+}
+
+func TestVersionsDisabled(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{"one", "two"} {
+		err = writeFile(client, "/a", 0, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := client.ListVersions("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Fatalf("Expected no versions, Got: %v", versions)
+	}
+
+	client.Exit()
+}
+
+func TestVersionsBounded(t *testing.T) {
+	config := puddlestore.DefaultConfig()
+	config.MaxVersions = 2
+	cluster, err := puddlestore.CreateCluster(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		err = writeFile(client, "/a", 0, []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := client.ListVersions("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version >= versions[1].Version {
+		t.Fatalf("Expected the 2 newest versions, Got: %v", versions)
+	}
+	out, err := readVersion(client, "/a", versions[1].Version, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != 3 {
+		t.Fatalf("Expected: [3], Got: %v", out)
+	}
+
+	client.Exit()
+}
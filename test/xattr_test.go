@@ -0,0 +1,96 @@
+package test
+
+import (
+	"errors"
+	"io/fs"
+	puddlestore "puddlestore/pkg"
+	"testing"
+)
+
+func TestXattrSetGetListRemove(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFile(client, "/a", 0, []byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.SetXattr("/a", "user.job", []byte("42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.SetXattr("/a", "user.content-type", []byte("text/plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := client.GetXattr("/a", "user.job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "42" {
+		t.Fatalf("Expected: 42, Got: %v", string(value))
+	}
+
+	// attributes survive a data commit
+	err = writeFile(client, "/a", 4, []byte("more"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := client.ListXattr("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "user.content-type" || names[1] != "user.job" {
+		t.Fatalf("Expected: [user.content-type user.job], Got: %v", names)
+	}
+
+	err = client.RemoveXattr("/a", "user.job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetXattr("/a", "user.job")
+	if err == nil {
+		t.Fatal("XattrSetGetListRemove Expected error for removed attribute")
+	}
+	err = client.RemoveXattr("/a", "user.job")
+	if err == nil {
+		t.Fatal("XattrSetGetListRemove Expected error when removing twice")
+	}
+	client.Exit()
+}
+
+func TestXattrSizeLimit(t *testing.T) {
+	cluster, err := puddlestore.CreateCluster(puddlestore.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Shutdown()
+
+	client, err := cluster.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Mkdir("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.SetXattr("/d", "user.big", make([]byte, puddlestore.MaxXattrSize))
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("SetXattr Expected invalid error, got", err)
+	}
+	err = client.SetXattr("/d", "user.small", make([]byte, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Exit()
+}